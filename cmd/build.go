@@ -21,7 +21,10 @@
 package cmd
 
 import (
+	"fmt"
+	"io"
 	"log"
+	"os"
 
 	"github.com/32leaves/riot/pkg/projectlib"
 	"github.com/spf13/cobra"
@@ -33,7 +36,9 @@ var buildCmd = &cobra.Command{
 	Short: "Builds applications of this project",
 	Long: `Builds all (or the given) application docker images in this project and
 pushes them to the main registry. After a successful build one can
-deploy either the latest images (the last build) or a previous build.`,
+deploy either the latest images (the last build) or a previous build.
+Applications with buildsOn: local, or all of them with --local, are built with
+the local Docker daemon instead of on a node.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		basedir := getBaseDir(cmd)
 
@@ -44,39 +49,83 @@ deploy either the latest images (the last build) or a previous build.`,
 		}
 
 		var apps []projectlib.Application
-        if len(args) > 0 {
-            app, err := env.GetApplication(args[0])
-            if err != nil {
-                log.Fatal(err)
-                return
-            }
-            apps = []projectlib.Application{app}
-        } else {
-            apps, err = env.GetApplications()
-            if err != nil {
-                log.Fatal("Error while loading application descriptions", err)
-                return
-            }
-        }
-
-		appToImage := make(map[string]string)
-		for _, app := range apps {
-			log.Printf("Building: %s\n", app.Name)
-			iamgeName, err := app.Build(env)
+		if len(args) > 0 {
+			app, err := env.GetApplication(args[0])
 			if err != nil {
-				log.Fatalf("Error while building %s\n%s", app.Name, err)
+				log.Fatal(err)
 				return
 			}
+			apps = []projectlib.Application{app}
+		} else {
+			apps, err = env.GetApplications()
+			if err != nil {
+				log.Fatal("Error while loading application descriptions", err)
+				return
+			}
+		}
+
+		history, err := projectlib.LoadHistory(basedir)
+		if err != nil {
+			log.Fatal("Error while loading build history: ", err)
+			return
+		}
+
+		lock, err := projectlib.LoadLock(basedir)
+		if os.IsNotExist(err) {
+			lock = projectlib.RiotLock{}
+		} else if err != nil {
+			log.Fatal("Error while loading riot lock: ", err)
+			return
+		}
 
-			appToImage[app.Name] = iamgeName
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		if local, _ := cmd.Flags().GetBool("local"); local {
+			for idx := range apps {
+				if !apps[idx].BuildsLocally() && apps[idx].GetTransfer(env) == projectlib.TransferDirect {
+					// deployments copy the image from the build node configured in application.yaml, which would not have it
+					log.Fatalf("Application %s copies its images from its build node (transfer: direct) and cannot be built with --local. Use buildsOn: local instead", apps[idx].Name)
+					return
+				}
+				apps[idx].BuildCfg.NodeSelector = projectlib.BuildLocal
+			}
+		}
+		imageNames := make([]string, len(apps))
+		tasks := make([]projectlib.Task, len(apps))
+		for idx, app := range apps {
+			idx, app := idx, app
+			tasks[idx] = func(out io.Writer) error {
+				log.New(out, "", log.LstdFlags).Printf("Building: %s\n", app.Name)
+				imageName, err := app.Build(env, out)
+				if err != nil {
+					return fmt.Errorf("error while building %s: %s", app.Name, err)
+				}
+				imageNames[idx] = imageName
+				return nil
+			}
+		}
+		errors := projectlib.RunParallel(parallel, os.Stderr, tasks)
+
+		for idx, app := range apps {
+			if errors[idx] != nil {
+				continue
+			}
+			lock.SetVersion(app.Name, imageNames[idx])
+			history.Add(app.Name, imageNames[idx])
+		}
+
+		err = history.Save(basedir)
+		if err != nil {
+			log.Fatal("Error while saving build history: ", err)
+			return
 		}
 
-		lock := projectlib.RiotLock{Versions: appToImage}
 		err = lock.Save(basedir)
 		if err != nil {
-			log.Fatal("Error while saving yarn lock: ", err)
+			log.Fatal("Error while saving riot lock: ", err)
 			return
 		}
+
+		fatalOnErrors("Error while building project", projectlib.RemoveNilErrors(errors))
 	},
 }
 
@@ -91,5 +140,6 @@ func init() {
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
-	// buildCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	buildCmd.Flags().Int("parallel", 1, "Number of applications to build at the same time")
+	buildCmd.Flags().Bool("local", false, "Build with the local Docker daemon instead of on the build nodes")
 }
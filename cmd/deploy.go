@@ -32,7 +32,15 @@ import (
 var deployCmd = &cobra.Command{
 	Use:   "deploy [app]",
 	Short: "Deploys applications of this project",
-	Long:  ``,
+	Long: `Deploys all (or the given) applications of this project to their target nodes.
+With --canary the new version only goes to some of the targets first. Once it proved
+itself, riot promote rolls it out to the remaining ones. With --dry-run nothing is
+deployed, instead the changes a deployment would make are shown (see riot plan).
+Nodes which already run an application with the same image and configuration are
+skipped unless --force is given. Afterwards, containers of applications which run on
+nodes they are no longer deployed to are removed, after asking or if --prune is given.
+Deployments to unreachable nodes are queued in riot.lock. Use --resume to deploy them
+once the nodes are back, or let riot watch take care of it.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		basedir := getBaseDir(cmd)
 
@@ -64,37 +72,105 @@ var deployCmd = &cobra.Command{
 			return
 		}
 
+		canarySelector, _ := cmd.Flags().GetString("canary")
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		force, _ := cmd.Flags().GetBool("force")
+		prune, _ := cmd.Flags().GetBool("prune")
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			printPlan(env, lock, apps, len(args) == 0, parallel, false)
+			return
+		}
+		if resume, _ := cmd.Flags().GetBool("resume"); resume {
+			names := make([]string, 0)
+			if len(args) > 0 {
+				names = append(names, args[0])
+			}
+			_, errors := projectlib.DrainPending(env, lock, names, parallel)
+			fatalOnErrors("Error while resuming deployments", errors)
+			return
+		}
+
 		errors := make([]error, 0)
 		for _, app := range apps {
-			hosts, err := app.SelectDeploymentTargets(env)
-			if err != nil {
-				errors = append(errors, err)
-				continue
+			if parallel > 0 {
+				app.RolloutCfg.MaxParallel = parallel
 			}
 
-			for _, host := range hosts {
-				log.Printf("Deploying \"%s\" on \"%s\"\n", app.Name, host.Name)
-				plock, err := app.Deploy(host, env, lock)
-
-				if err != nil {
-					errors = append(errors, err)
-				} else {
-					lock = *plock
-					lock.Save(basedir)
-				}
+			var errs []error
+			if canarySelector != "" {
+				lock, errs = deployCanary(app, env, lock, canarySelector, force)
+			} else {
+				lock, errs = deployApplication(app, env, lock, force)
 			}
+			errors = append(errors, errs...)
 		}
 
-		if len(errors) > 0 {
-			errorMessages := ""
-			for _, err := range errors {
-				errorMessages += fmt.Sprintf("%s\n", err)
-			}
-			log.Fatalf("Error while deploying project: %s", errorMessages)
+		if canarySelector == "" {
+			var errs []error
+			lock, errs = removeOrphans(env, lock, apps, len(args) == 0, prune, parallel)
+			errors = append(errors, errs...)
 		}
+
+		fatalOnErrors("Error while deploying project", errors)
 	},
 }
 
+// deployApplication rolls an application out to all of its target nodes, which ends any canary of it. Unless force
+// is true, nodes which are already up to date are skipped.
+func deployApplication(app projectlib.Application, env projectlib.Environment, lock projectlib.RiotLock, force bool) (projectlib.RiotLock, []error) {
+	hosts, err := app.SelectDeploymentTargets(env)
+	if err != nil {
+		return lock, []error{err}
+	}
+
+	lock, errs := app.Rollout(hosts, env, lock, force)
+	if _, ok := lock.GetCanary(app.Name); ok && len(errs) == 0 {
+		// all targets run the same image now, so there is nothing left to promote
+		lock.EndCanary(app.Name)
+		err = lock.Save(env.GetBaseDir())
+		if err != nil {
+			return lock, []error{err}
+		}
+	}
+	return lock, errs
+}
+
+// deployCanary rolls an application out to the canary nodes among its targets. The canary is only recorded in
+// the lock if it was deployed to all of them successfully, so that a failed one cannot be promoted.
+func deployCanary(app projectlib.Application, env projectlib.Environment, lock projectlib.RiotLock, selector string, force bool) (projectlib.RiotLock, []error) {
+	canaries, err := app.SelectCanaries(env, selector)
+	if err != nil {
+		return lock, []error{err}
+	}
+
+	for _, node := range canaries {
+		log.Printf("Using \"%s\" as canary for \"%s\"\n", node.Name, app.Name)
+	}
+	lock, errs := app.Rollout(canaries, env, lock, force)
+	if len(errs) > 0 {
+		return lock, errs
+	}
+
+	lock.StartCanary(app.Name, canaries)
+	err = lock.Save(env.GetBaseDir())
+	if err != nil {
+		return lock, []error{err}
+	}
+	return lock, nil
+}
+
+func fatalOnErrors(message string, errors []error) {
+	if len(errors) == 0 {
+		return
+	}
+
+	errorMessages := ""
+	for _, err := range errors {
+		errorMessages += fmt.Sprintf("%s\n", err)
+	}
+	log.Fatalf("%s: %s", message, errorMessages)
+}
+
 func init() {
 	rootCmd.AddCommand(deployCmd)
 
@@ -106,5 +182,10 @@ func init() {
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
-	// deployCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	deployCmd.Flags().String("canary", "", "Only deploy to the targets matching this node selector or percentage (e.g. 10%). Use riot promote to complete the rollout")
+	deployCmd.Flags().BoolP("force", "f", false, "Recreate containers even if they are up to date")
+	deployCmd.Flags().Bool("prune", false, "Remove containers of applications from nodes they are no longer deployed to without asking")
+	deployCmd.Flags().Bool("resume", false, "Only deploy what is pending on nodes which were unreachable before")
+	deployCmd.Flags().BoolP("dry-run", "n", false, "Only show what would change")
+	deployCmd.Flags().Int("parallel", 0, "Number of nodes to deploy to at the same time. Overrides the maxParallel rollout setting of the applications")
 }
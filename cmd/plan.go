@@ -0,0 +1,146 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/32leaves/riot/pkg/projectlib"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan [app]",
+	Short: "Shows what deploying applications of this project would change",
+	Long: `Compares the versions in riot.lock and the run configuration of all (or the given)
+applications with what is actually running on each node and prints which containers
+a deployment would create, replace or remove, and which are unchanged.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		basedir := getBaseDir(cmd)
+
+		env, err := projectlib.LoadEnv(basedir)
+		if err != nil {
+			log.Fatal("Error while loading environment from ", basedir, "\n", err)
+			return
+		}
+
+		var apps []projectlib.Application
+		if len(args) > 0 {
+			app, err := env.GetApplication(args[0])
+			if err != nil {
+				log.Fatal(err)
+				return
+			}
+			apps = []projectlib.Application{app}
+		} else {
+			apps, err = env.GetApplications()
+			if err != nil {
+				log.Fatal("Error while loading application descriptions", err)
+				return
+			}
+		}
+
+		lock, err := projectlib.LoadLock(env.GetBaseDir())
+		if err != nil {
+			log.Fatal(err, ". Please run riot build.")
+			return
+		}
+
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		printPlan(env, lock, apps, len(args) == 0, parallel, asJSON)
+	},
+}
+
+// printPlan computes the plan of all nodes and prints it, either for humans or as JSON
+func printPlan(env projectlib.Environment, lock projectlib.RiotLock, apps []projectlib.Application, complete bool, parallel int, asJSON bool) {
+	nodes := env.GetNodes()
+	plans := make([][]projectlib.PlanAction, len(nodes))
+	tasks := make([]projectlib.Task, len(nodes))
+	for idx, node := range nodes {
+		idx, node := idx, node
+		tasks[idx] = func(out io.Writer) error {
+			var err error
+			plans[idx], err = node.Plan(env, lock, apps, complete)
+			return err
+		}
+	}
+	errors := projectlib.RemoveNilErrors(projectlib.RunParallel(parallel, os.Stderr, tasks))
+
+	if asJSON {
+		actions := make([]projectlib.PlanAction, 0)
+		for _, plan := range plans {
+			actions = append(actions, plan...)
+		}
+		out, err := json.MarshalIndent(actions, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+		fmt.Println(string(out))
+	} else {
+		createColor := color.New(color.FgGreen).SprintFunc()
+		replaceColor := color.New(color.FgYellow).SprintFunc()
+		removeColor := color.New(color.Bold, color.FgRed).SprintFunc()
+		for idx, node := range nodes {
+			if len(plans[idx]) == 0 {
+				continue
+			}
+
+			fmt.Printf("%s:\n", node.Name)
+			for _, action := range plans[idx] {
+				switch action.Action {
+				case projectlib.PlanCreate:
+					fmt.Println(createColor(fmt.Sprintf("  + %s (%s)", action.Application, action.Image)))
+				case projectlib.PlanReplace:
+					fmt.Println(replaceColor(fmt.Sprintf("  ~ %s (%s: %s -> %s)", action.Application, action.Reason, action.CurrentImage, action.Image)))
+				case projectlib.PlanRemove:
+					fmt.Println(removeColor(fmt.Sprintf("  - %s (container %s)", action.Application, action.Container)))
+				default:
+					fmt.Printf("    %s (%s)\n", action.Application, action.Image)
+				}
+			}
+		}
+	}
+
+	fatalOnErrors("Error while planning deployment", errors)
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// planCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	planCmd.Flags().Bool("json", false, "Print the plan as JSON")
+	planCmd.Flags().Int("parallel", 10, "Number of nodes to contact at the same time")
+}
@@ -0,0 +1,125 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/32leaves/riot/pkg/projectlib"
+	"github.com/spf13/cobra"
+)
+
+// promoteCmd represents the promote command
+var promoteCmd = &cobra.Command{
+	Use:   "promote [app]",
+	Short: "Completes canary deployments",
+	Long: `Rolls the image of a canary deployment (see riot deploy --canary) out to the
+remaining targets of all (or the given) applications. If an application was built
+again since its canary was deployed, promoting requires --force.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		basedir := getBaseDir(cmd)
+
+		env, err := projectlib.LoadEnv(basedir)
+		if err != nil {
+			log.Fatal("Error while loading environment from ", basedir, "\n", err)
+			return
+		}
+
+		var apps []projectlib.Application
+		if len(args) > 0 {
+			app, err := env.GetApplication(args[0])
+			if err != nil {
+				log.Fatal(err)
+				return
+			}
+			apps = []projectlib.Application{app}
+		} else {
+			apps, err = env.GetApplications()
+			if err != nil {
+				log.Fatal("Error while loading application descriptions", err)
+				return
+			}
+		}
+
+		lock, err := projectlib.LoadLock(env.GetBaseDir())
+		if err != nil {
+			log.Fatal(err, ". Please run riot build.")
+			return
+		}
+
+		force, _ := cmd.Flags().GetBool("force")
+		errors := make([]error, 0)
+		for _, app := range apps {
+			canary, ok := lock.GetCanary(app.Name)
+			if !ok {
+				if len(args) > 0 {
+					errors = append(errors, fmt.Errorf("application %s has no canary to promote", app.Name))
+				}
+				continue
+			}
+
+			if lock.Versions[app.Name] != canary.Image {
+				if !force {
+					errors = append(errors, fmt.Errorf("application %s was built again since its canary %s was deployed. Use --force to promote the canary anyway", app.Name, canary.Image))
+					continue
+				}
+				log.Printf("\"%s\" was built again since its canary was deployed. Promoting the canary %s\n", app.Name, canary.Image)
+				lock.SetVersion(app.Name, canary.Image)
+			}
+
+			targets, err := app.SelectPromotionTargets(env, canary)
+			if err != nil {
+				errors = append(errors, err)
+				continue
+			}
+
+			log.Printf("Promoting \"%s\" to %d more nodes\n", app.Name, len(targets))
+			var errs []error
+			lock, errs = app.Rollout(targets, env, lock, false)
+			if len(errs) == 0 {
+				lock.EndCanary(app.Name)
+			}
+			errors = append(errors, errs...)
+		}
+
+		err = lock.Save(basedir)
+		if err != nil {
+			log.Fatal("Error while saving riot lock: ", err)
+			return
+		}
+		fatalOnErrors("Error while promoting project", errors)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(promoteCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// promoteCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	promoteCmd.Flags().BoolP("force", "f", false, "Promote canaries even if their application was built again since")
+}
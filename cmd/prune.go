@@ -0,0 +1,107 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/32leaves/riot/pkg/projectlib"
+	"github.com/spf13/cobra"
+)
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Removes stopped containers and unused images from all nodes",
+	Long: `Finds containers deployed by riot which are no longer running, as well as images
+built by riot which are not in use anymore, on each node and removes them.
+The most recent builds of each application are kept so that riot rollback can
+still deploy them, use --keep to change how many. Use --dry-run to see what
+would be removed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		basedir := getBaseDir(cmd)
+
+		env, err := projectlib.LoadEnv(basedir)
+		if err != nil {
+			log.Fatal("Error while loading environment from ", basedir, "\n", err)
+			return
+		}
+
+		lock, err := projectlib.LoadLock(env.GetBaseDir())
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+			return
+		}
+
+		history, err := projectlib.LoadHistory(env.GetBaseDir())
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+
+		keep, _ := cmd.Flags().GetInt("keep")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		verb := "Removed"
+		if dryRun {
+			verb = "Would remove"
+		}
+
+		failed := false
+		for _, node := range env.GetNodes() {
+			if !node.IsAvailable() {
+				log.Printf("Node %s is not available, skipping it\n", node.Name)
+				continue
+			}
+
+			actions, kept, err := node.Prune(env, lock, history, keep, dryRun)
+			for _, action := range actions {
+				log.Printf("%s %s on %s\n", verb, action, node.Name)
+			}
+			for _, action := range kept {
+				log.Printf("Kept %s on %s for riot rollback\n", action, node.Name)
+			}
+			if err != nil {
+				log.Printf("Error while pruning %s: %s\n", node.Name, err)
+				failed = true
+			}
+		}
+
+		if failed {
+			log.Fatal("Error while pruning project")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// pruneCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	pruneCmd.Flags().BoolP("dry-run", "n", false, "Only show what would be removed")
+	pruneCmd.Flags().Int("keep", 3, "Number of most recent builds of each application which are kept for riot rollback")
+}
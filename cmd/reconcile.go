@@ -0,0 +1,80 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"log"
+	"time"
+
+	"github.com/32leaves/riot/pkg/projectlib"
+	"github.com/spf13/cobra"
+)
+
+// reconcileCmd represents the reconcile command
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Brings all nodes in line with this project",
+	Long: `Compares the applications, environment and riot.lock of this project with the containers
+actually running on each node, and deploys whatever is missing, stopped or outdated.
+With --loop this keeps going, reconciling periodically and whenever a project file
+changes. Offline nodes are retried less and less often until they come back.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		loop, _ := cmd.Flags().GetBool("loop")
+		runReconciler(cmd, loop)
+	},
+}
+
+// runReconciler reconciles the project once or, if loop is true, until riot is stopped
+func runReconciler(cmd *cobra.Command, loop bool) {
+	reconciler := projectlib.Reconciler{Basedir: getBaseDir(cmd)}
+	reconciler.Interval, _ = cmd.Flags().GetDuration("interval")
+	reconciler.Parallel, _ = cmd.Flags().GetInt("parallel")
+	reconciler.Prune, _ = cmd.Flags().GetBool("prune")
+
+	if loop {
+		log.Printf("Reconciling %s every %s\n", reconciler.Basedir, reconciler.Interval)
+		reconciler.Run(nil)
+		return
+	}
+	fatalOnErrors("Error while reconciling project", reconciler.Reconcile())
+}
+
+// addReconcileFlags adds the flags shared by reconcile and watch
+func addReconcileFlags(cmd *cobra.Command) {
+	cmd.Flags().Duration("interval", time.Minute, "Time between two reconciliations")
+	cmd.Flags().Int("parallel", 10, "Number of nodes to reconcile at the same time")
+	cmd.Flags().Bool("prune", false, "Remove containers of applications from nodes they are no longer deployed to")
+}
+
+func init() {
+	rootCmd.AddCommand(reconcileCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// reconcileCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	reconcileCmd.Flags().Bool("loop", false, "Keep reconciling until stopped")
+	addReconcileFlags(reconcileCmd)
+}
@@ -0,0 +1,88 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/32leaves/riot/pkg/projectlib"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// renderCmd represents the render command
+var renderCmd = &cobra.Command{
+	Use:   "render <app> <node>",
+	Short: "Shows the configuration of an application as it would be deployed to a node",
+	Long: `Renders the templates in application.yaml for a particular node and prints the
+resulting application configuration.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		basedir := getBaseDir(cmd)
+
+		env, err := projectlib.LoadEnv(basedir)
+		if err != nil {
+			log.Fatal("Error while loading environment from ", basedir, "\n", err)
+			return
+		}
+
+		app, err := env.GetApplication(args[0])
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+		nodes, err := env.SelectNodes("#" + args[1])
+		if err != nil {
+			log.Fatal(err)
+			return
+		} else if len(nodes) == 0 {
+			log.Fatalf("Node %s not found", args[1])
+			return
+		}
+
+		rendered, err := app.Render(nodes[0])
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+		out, err := yaml.Marshal(rendered)
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+		fmt.Print(string(out))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// renderCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// renderCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
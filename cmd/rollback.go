@@ -0,0 +1,120 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"log"
+
+	"github.com/32leaves/riot/pkg/projectlib"
+	"github.com/spf13/cobra"
+)
+
+// rollbackCmd represents the rollback command
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [app]",
+	Short: "Redeploys a previous build of applications",
+	Long: `Redeploys the build prior to the current one of all (or the given) applications
+to all their target nodes. Use --to to go back to a particular build, either by its
+version or its full image name (see riot.history).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		basedir := getBaseDir(cmd)
+
+		env, err := projectlib.LoadEnv(basedir)
+		if err != nil {
+			log.Fatal("Error while loading environment from ", basedir, "\n", err)
+			return
+		}
+
+		version, _ := cmd.Flags().GetString("to")
+		if version != "" && len(args) == 0 {
+			log.Fatal("Please name the application to roll back when using --to")
+			return
+		}
+
+		var apps []projectlib.Application
+		if len(args) > 0 {
+			app, err := env.GetApplication(args[0])
+			if err != nil {
+				log.Fatal(err)
+				return
+			}
+			apps = []projectlib.Application{app}
+		} else {
+			apps, err = env.GetApplications()
+			if err != nil {
+				log.Fatal("Error while loading application descriptions", err)
+				return
+			}
+		}
+
+		lock, err := projectlib.LoadLock(env.GetBaseDir())
+		if err != nil {
+			log.Fatal(err, ". Please run riot build.")
+			return
+		}
+		history, err := projectlib.LoadHistory(env.GetBaseDir())
+		if err != nil {
+			log.Fatal("Error while loading build history: ", err)
+			return
+		}
+
+		errors := make([]error, 0)
+		for _, app := range apps {
+			var imageName string
+			if version != "" {
+				imageName, err = history.FindVersion(app.Name, version)
+			} else {
+				imageName, err = history.Previous(app.Name, lock.Versions[app.Name])
+			}
+			if err != nil {
+				errors = append(errors, err)
+				continue
+			}
+
+			log.Printf("Rolling back \"%s\" to %s\n", app.Name, imageName)
+			lock.SetVersion(app.Name, imageName)
+			var errs []error
+			lock, errs = deployApplication(app, env, lock, false)
+			errors = append(errors, errs...)
+		}
+
+		err = lock.Save(basedir)
+		if err != nil {
+			log.Fatal("Error while saving riot lock: ", err)
+			return
+		}
+		fatalOnErrors("Error while rolling back project", errors)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// rollbackCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	rollbackCmd.Flags().String("to", "", "Version or image name of the build to roll back to")
+}
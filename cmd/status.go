@@ -21,7 +21,11 @@
 package cmd
 
 import (
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/32leaves/riot/pkg/projectlib"
 	"github.com/fatih/color"
@@ -54,27 +58,38 @@ var statusCmd = &cobra.Command{
 		bar.PrependFunc(func(b *uiprogress.Bar) string {
 			return nodes[b.Current()-1].Name
 		})
-		hostAvailability := make([]bool, len(env.GetNodes()))
-		for idx, node := range env.GetNodes() {
-			bar.Incr()
-			hostAvailability[idx] = node.IsAvailable()
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		hostAvailability := make([]bool, len(nodes))
+		nodeAvailability := make(map[string]bool)
+		tasks := make([]projectlib.Task, len(nodes))
+		for idx, node := range nodes {
+			idx, node := idx, node
+			tasks[idx] = func(out io.Writer) error {
+				bar.Incr()
+				hostAvailability[idx] = node.IsAvailable()
+				return nil
+			}
+		}
+		projectlib.RunParallel(parallel, os.Stderr, tasks)
+		for idx, node := range nodes {
+			nodeAvailability[node.Name] = hostAvailability[idx]
 		}
 
 		var apps []projectlib.Application
-        if len(args) > 0 {
-            app, err := env.GetApplication(args[0])
-            if err != nil {
-                log.Fatal(err)
-                return
-            }
-            apps = []projectlib.Application{app}
-        } else {
-            apps, err = env.GetApplications()
-            if err != nil {
-                log.Fatal("Error while loading application descriptions", err)
-                return
-            }
-        }
+		if len(args) > 0 {
+			app, err := env.GetApplication(args[0])
+			if err != nil {
+				log.Fatal(err)
+				return
+			}
+			apps = []projectlib.Application{app}
+		} else {
+			apps, err = env.GetApplications()
+			if err != nil {
+				log.Fatal("Error while loading application descriptions", err)
+				return
+			}
+		}
 		lock, err := projectlib.LoadLock(env.GetBaseDir())
 		if err != nil {
 			log.Fatal(err, ". Please run riot build.")
@@ -85,28 +100,52 @@ var statusCmd = &cobra.Command{
 		bar.PrependFunc(func(b *uiprogress.Bar) string {
 			return apps[b.Current()-1].Name
 		})
-		applicationAvailability := make([]map[string]bool, len(apps))
+		type probe struct {
+			app    int
+			node   projectlib.Node
+			status projectlib.AppStatus
+		}
+		probes := make([]*probe, 0)
 		for idx, app := range apps {
 			bar.Incr()
 
-			applicationAvailability[idx] = make(map[string]bool)
 			hosts, err := app.SelectDeploymentTargets(env)
 			if err != nil {
 				log.Fatal(err)
 			}
 			for _, node := range hosts {
-				imageName, ok := lock.Versions[app.Name]
-				if !ok {
-					log.Fatalf("Application %s does not have a corrensopning riot.lock entry. Please run 'riot build'.", app.Name)
-					return
+				probes = append(probes, &probe{app: idx, node: node})
+			}
+		}
+
+		tasks = make([]projectlib.Task, len(probes))
+		for idx, p := range probes {
+			p := p
+			tasks[idx] = func(out io.Writer) error {
+				if !nodeAvailability[p.node.Name] {
+					// no need to wait for a node we know is down
+					return nil
 				}
-				applicationAvailability[idx][node.Name], err = node.HasAppRunning(imageName, env)
-				if err != nil {
-					log.Fatal(err)
-					return
+
+				app := apps[p.app]
+				if _, ok := lock.Versions[app.Name]; !ok {
+					return fmt.Errorf("application %s does not have a corresponding riot.lock entry. Please run 'riot build'", app.Name)
 				}
+
+				var err error
+				p.status, err = p.node.GetAppStatus(&app, env)
+				return err
 			}
 		}
+		fatalOnErrors("Error while computing application status", projectlib.RemoveNilErrors(projectlib.RunParallel(parallel, os.Stderr, tasks)))
+
+		applicationAvailability := make([]map[string]projectlib.AppStatus, len(apps))
+		for idx := range apps {
+			applicationAvailability[idx] = make(map[string]projectlib.AppStatus)
+		}
+		for _, p := range probes {
+			applicationAvailability[p.app][p.node.Name] = p.status
+		}
 
 		if showbar {
 			uiprogress.Stop()
@@ -114,6 +153,7 @@ var statusCmd = &cobra.Command{
 
 		downColor := color.New(color.Bold, color.FgRed).SprintFunc()
 		upColor := color.New(color.FgGreen).SprintFunc()
+		warnColor := color.New(color.FgYellow).SprintFunc()
 		for idx, node := range env.GetNodes() {
 			var status string
 			if hostAvailability[idx] {
@@ -122,16 +162,35 @@ var statusCmd = &cobra.Command{
 				status = downColor("down")
 			}
 			log.Printf("Host %s (node %s) is %s\n", node.Host, node.Name, status)
+			for _, pending := range lock.GetPending(node.Name) {
+				log.Printf("  pending: %s (%s, queued at %s)\n", pending.Application, pending.Image, pending.Queued)
+			}
 		}
 		for idx, app := range apps {
 			statement := app.Name + ":"
+			canary, hasCanary := lock.GetCanary(app.Name)
 			for hn, status := range applicationAvailability[idx] {
-				if status {
+				if !status.Running {
+					statement += downColor(" -" + hn)
+				} else if status.Image != lock.Versions[app.Name] {
+					// nodes outside of a canary keep running the previous image until it is promoted
+					if hasCanary && canary.Image == lock.Versions[app.Name] {
+						statement += warnColor(" ~" + hn + " (canary pending)")
+					} else {
+						statement += warnColor(" ~" + hn + " (outdated)")
+					}
+				} else if status.IsHealthy() {
 					statement += upColor(" +" + hn)
 				} else {
-					statement += downColor(" -" + hn)
+					statement += warnColor(" ~" + hn + " (" + status.Health + ")")
 				}
 			}
+			if hasCanary {
+				statement += fmt.Sprintf(" (canary %s on %s)", canary.Image, strings.Join(canary.Nodes, ", "))
+			}
+			if aborted, ok := lock.GetAbortedRollout(app.Name); ok {
+				statement += fmt.Sprintf(" (rollout of %s aborted at %s)", aborted.Image, aborted.Aborted)
+			}
 			log.Println(statement)
 		}
 	},
@@ -149,4 +208,5 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	statusCmd.Flags().BoolP("progress-bar", "p", false, "Show a progress bar while computing status")
+	statusCmd.Flags().Int("parallel", 10, "Number of nodes to contact at the same time")
 }
@@ -0,0 +1,267 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/32leaves/riot/pkg/projectlib"
+	"github.com/spf13/cobra"
+)
+
+// undeployCmd represents the undeploy command
+var undeployCmd = &cobra.Command{
+	Use:   "undeploy [app]",
+	Short: "Removes applications of this project from their nodes",
+	Long: `Stops and removes the containers of all (or the given) applications of this project
+from all nodes, or only from the node given with --node. This also removes containers of
+applications which no longer exist in the project. Removing all applications has to be
+confirmed, unless --yes is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		basedir := getBaseDir(cmd)
+
+		env, err := projectlib.LoadEnv(basedir)
+		if err != nil {
+			log.Fatal("Error while loading environment from ", basedir, "\n", err)
+			return
+		}
+
+		app := ""
+		if len(args) > 0 {
+			app = args[0]
+		}
+
+		lock, err := projectlib.LoadLock(env.GetBaseDir())
+		hasLock := err == nil
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+			return
+		}
+
+		nodes := env.GetNodes()
+		if nodeName, _ := cmd.Flags().GetString("node"); nodeName != "" {
+			nodes, err = env.SelectNodes("#" + nodeName)
+			if err != nil {
+				log.Fatal(err)
+				return
+			} else if len(nodes) == 0 {
+				log.Fatalf("Node %s not found", nodeName)
+				return
+			}
+		}
+
+		if yes, _ := cmd.Flags().GetBool("yes"); app == "" && !yes {
+			if !confirm(fmt.Sprintf("Remove all applications of %s from %d nodes?", env.GetName(), len(nodes))) {
+				log.Println("Not removing anything.")
+				return
+			}
+		}
+
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		skipped := make([]bool, len(nodes))
+		found := make([]bool, len(nodes))
+		tasks := make([]projectlib.Task, len(nodes))
+		for idx, node := range nodes {
+			idx, node := idx, node
+			tasks[idx] = func(out io.Writer) error {
+				logger := log.New(out, "", log.LstdFlags)
+				if !node.IsAvailable() {
+					logger.Printf("Node %s is not available, skipping it\n", node.Name)
+					skipped[idx] = true
+					return nil
+				}
+
+				removed, err := node.Undeploy(env, app)
+				found[idx] = len(removed) > 0
+				for _, name := range removed {
+					logger.Printf("Removed %s from %s\n", name, node.Name)
+				}
+				if err != nil {
+					return fmt.Errorf("error while undeploying from %s: %s", node.Name, err)
+				}
+				return nil
+			}
+		}
+		errors := projectlib.RunParallel(parallel, os.Stderr, tasks)
+
+		if app != "" && !isKnownApplication(env, lock, app, found) {
+			log.Fatalf("Application %s is not part of this project and was not found on any reachable node", app)
+			return
+		}
+
+		if hasLock {
+			for idx, node := range nodes {
+				if skipped[idx] {
+					// nothing can be removed yet, but at least nothing new gets deployed once the node is back
+					forgetPending(&lock, app, node.Name)
+					continue
+				} else if errors[idx] != nil {
+					continue
+				}
+				forgetDeployments(&lock, app, node.Name)
+			}
+			lock.Save(env.GetBaseDir())
+		}
+
+		fatalOnErrors("Error while undeploying project", projectlib.RemoveNilErrors(errors))
+	},
+}
+
+// isKnownApplication returns true if app is an application of the project, is recorded in the lock or had a
+// container on one of the nodes
+func isKnownApplication(env projectlib.Environment, lock projectlib.RiotLock, app string, found []bool) bool {
+	if _, err := env.GetApplication(app); err == nil {
+		return true
+	}
+	if _, ok := lock.Versions[app]; ok {
+		return true
+	}
+	if _, ok := lock.Deployment[app]; ok {
+		return true
+	}
+	for _, f := range found {
+		if f {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetDeployments removes an application, or all applications if app is empty, on a node from the lock
+func forgetDeployments(lock *projectlib.RiotLock, app string, node string) {
+	if app != "" {
+		lock.RemoveDeployment(app, node)
+		forgetPending(lock, app, node)
+		return
+	}
+
+	for name := range lock.Deployment {
+		lock.RemoveDeployment(name, node)
+	}
+	for name := range lock.Outcomes {
+		lock.RemoveDeployment(name, node)
+	}
+	forgetPending(lock, "", node)
+}
+
+// forgetPending drops the deployments of an application, or of all applications if app is empty, pending on a node
+func forgetPending(lock *projectlib.RiotLock, app string, node string) {
+	for _, pending := range lock.GetPending(node) {
+		if app == "" || pending.Application == app {
+			lock.ClearPending(node, pending.Application)
+		}
+	}
+}
+
+// removeOrphans removes the containers of applications which run on nodes they are no longer deployed to.
+// Unless prune is true the user is asked first. If complete is false, only containers of apps are considered.
+func removeOrphans(env projectlib.Environment, lock projectlib.RiotLock, apps []projectlib.Application, complete bool, prune bool, parallel int) (projectlib.RiotLock, []error) {
+	nodes := env.GetNodes()
+	orphans := make([][]projectlib.PlanAction, len(nodes))
+	tasks := make([]projectlib.Task, len(nodes))
+	for idx, node := range nodes {
+		idx, node := idx, node
+		tasks[idx] = func(out io.Writer) error {
+			plan, err := node.Plan(env, lock, apps, complete)
+			if err != nil {
+				log.New(out, "", log.LstdFlags).Printf("Unable to look for containers to remove on %s: %s\n", node.Name, err)
+				return nil
+			}
+			for _, action := range plan {
+				if action.Action == projectlib.PlanRemove {
+					orphans[idx] = append(orphans[idx], action)
+				}
+			}
+			return nil
+		}
+	}
+	projectlib.RunParallel(parallel, os.Stderr, tasks)
+
+	count := 0
+	for _, actions := range orphans {
+		for _, action := range actions {
+			log.Printf("\"%s\" is no longer deployed to \"%s\" but still runs there (container %s)\n", action.Application, action.Node, action.Container)
+			count++
+		}
+	}
+	if count == 0 {
+		return lock, nil
+	}
+	if !prune && !confirm(fmt.Sprintf("Remove these %d containers?", count)) {
+		log.Println("Not removing anything. Use riot deploy --prune or riot undeploy to remove them.")
+		return lock, nil
+	}
+
+	errors := make([]error, 0)
+	for idx, node := range nodes {
+		removed := make(map[string]bool)
+		for _, action := range orphans[idx] {
+			if removed[action.Application] {
+				continue
+			}
+
+			_, err := node.Undeploy(env, action.Application)
+			if err != nil {
+				errors = append(errors, fmt.Errorf("error while removing %s from %s: %s", action.Application, node.Name, err))
+				continue
+			}
+			removed[action.Application] = true
+			forgetDeployments(&lock, action.Application, node.Name)
+			log.Printf("Removed \"%s\" from \"%s\"\n", action.Application, node.Name)
+		}
+	}
+	lock.Save(env.GetBaseDir())
+	return lock, errors
+}
+
+// confirm asks the user a yes/no question on the terminal. Anything but yes, including no input at all, is a no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		fmt.Println()
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func init() {
+	rootCmd.AddCommand(undeployCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// undeployCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	undeployCmd.Flags().String("node", "", "Only undeploy from this node")
+	undeployCmd.Flags().Int("parallel", 10, "Number of nodes to undeploy from at the same time")
+	undeployCmd.Flags().BoolP("yes", "y", false, "Remove all applications without asking")
+}
@@ -21,39 +21,85 @@
 package projectlib
 
 import (
-	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"time"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
 	yaml "gopkg.in/yaml.v2"
 )
 
 // Application represnts a single app in a riot project
 type Application struct {
 	Name               string
-	DeploymentSelector []string `yaml:"deploysTo"`
-	BuildCfg           AppBuild `yaml:"build"`
-	Image              string   `yaml:"image"`
-	RunCfg             AppRun   `yaml:"run"`
+	DeploymentSelector []string   `yaml:"deploysTo"`
+	BuildCfg           AppBuild   `yaml:"build"`
+	Image              string     `yaml:"image,omitempty"`
+	RunCfg             AppRun     `yaml:"run"`
+	RolloutCfg         AppRollout `yaml:"rollout,omitempty"`
+	Transfer           string     `yaml:"transfer,omitempty"`
 }
 
+// BuildLocal as build node selector builds an application with the Docker daemon riot runs next to
+const BuildLocal = "local"
+
 // AppBuild contains all settings related to an application build
 type AppBuild struct {
 	NodeSelector string             `yaml:"buildsOn"`
 	Args         map[string]*string `yaml:"args"`
 	DontPush     bool               `yaml:"dontPush"`
+	Platform     string             `yaml:"platform,omitempty"`
 }
 
 // AppRun configures an application during runtime
 type AppRun struct {
-	Priviliged bool              `yaml:"priviliged"`
-	Volumes    map[string]string `yaml:"volumes"`
-	Ports      map[string]string `yaml:"ports"`
+	Priviliged        bool                         `yaml:"priviliged,omitempty"`
+	Volumes           AppVolumes                   `yaml:"volumes,omitempty"`
+	Ports             map[string]string            `yaml:"ports,omitempty"`
+	Restart           string                       `yaml:"restart,omitempty"`
+	RemoveVolumes     bool                         `yaml:"removeVolumes,omitempty"`
+	StartTimeout      time.Duration                `yaml:"startTimeout,omitempty"`
+	Env               map[string]string            `yaml:"env,omitempty"`
+	EnvFile           StringList                   `yaml:"envFile,omitempty"`
+	NodeEnv           map[string]map[string]string `yaml:"nodeEnv,omitempty"`
+	Devices           []string                     `yaml:"devices,omitempty"`
+	CapAdd            []string                     `yaml:"capAdd,omitempty"`
+	CapDrop           []string                     `yaml:"capDrop,omitempty"`
+	GroupAdd          []string                     `yaml:"groupAdd,omitempty"`
+	DeviceCgroupRules []string                     `yaml:"deviceCgroupRules,omitempty"`
+	Limits            AppLimits                    `yaml:"limits,omitempty"`
+	Command           []string                     `yaml:"command,omitempty"`
+	Entrypoint        []string                     `yaml:"entrypoint,omitempty"`
+	User              string                       `yaml:"user,omitempty"`
+	Workdir           string                       `yaml:"workdir,omitempty"`
+	Hostname          string                       `yaml:"hostname,omitempty"`
+	Tty               bool                         `yaml:"tty,omitempty"`
+	Stdin             bool                         `yaml:"stdin,omitempty"`
+	NetworkMode       string                       `yaml:"networkMode,omitempty"`
+	Networks          []string                     `yaml:"networks,omitempty"`
+	Healthcheck       AppHealthcheck               `yaml:"healthcheck,omitempty"`
+}
+
+// StringList is a list of strings which can also be written as a single string
+type StringList []string
+
+// UnmarshalYAML accepts either a single string or a list of strings
+func (list *StringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*list = StringList{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := unmarshal(&multiple); err != nil {
+		return err
+	}
+	*list = multiple
+	return nil
 }
 
 // LoadApp loads the application manifest from an application folder
@@ -80,6 +126,11 @@ func LoadApp(basedir string) (*Application, error) {
 	return &result, nil
 }
 
+// getBaseDir returns the directory containing the application manifest
+func (app *Application) getBaseDir(env Environment) string {
+	return filepath.Join(env.GetBaseDir(), "applications", app.Name)
+}
+
 // SelectDeploymentTargets selects all nodes in an environment to which an application ought to be deployed
 func (app *Application) SelectDeploymentTargets(env Environment) ([]Node, error) {
 	selectedNodes := make(map[string]Node)
@@ -104,30 +155,11 @@ func (app *Application) SelectDeploymentTargets(env Environment) ([]Node, error)
 	return result, nil
 }
 
-// HasAppRunning checks if an application is currently deployed on a node
-func (node Node) HasAppRunning(imageName string, env Environment) (bool, error) {
-	ctx := context.Background()
-	client, err := node.GetDockerClient(ctx, env)
-	if err != nil {
-		return false, err
-	}
-
-	filters := filters.NewArgs()
-	filters.Add("label", imageName)
-	options := types.ContainerListOptions{
-		All:     true,
-		Filters: filters,
-	}
-	containers, err := client.ContainerList(ctx, options)
-	if err != nil {
-		return false, err
-	}
-
-	return len(containers) > 0, nil
-}
-
 // GetBuildNode returns the node on which we should build the application image
 func (app *Application) GetBuildNode(env Environment) (Node, error) {
+	if app.BuildsLocally() {
+		return Node{}, fmt.Errorf("Application %s is built locally, not on a node", app.Name)
+	}
 	if len(app.BuildCfg.NodeSelector) > 0 {
 		nodes, err := env.SelectNodes(app.BuildCfg.NodeSelector)
 		if err != nil {
@@ -146,3 +178,30 @@ func (app *Application) GetBuildNode(env Environment) (Node, error) {
 
 	return nodes[0], nil
 }
+
+// BuildsLocally returns true if the application is built with the local Docker daemon instead of on a node
+func (app *Application) BuildsLocally() bool {
+	return app.BuildCfg.NodeSelector == BuildLocal
+}
+
+// getBuildClient connects to the Docker daemon the application is built with and returns it with a name for logging.
+// Build nodes are checked within their timeout, so that an offline build node fails quickly.
+func (app *Application) getBuildClient(env Environment) (*client.Client, string, error) {
+	if app.BuildsLocally() {
+		cli, err := client.NewClientWithOpts(client.WithVersion("1.37"), client.FromEnv)
+		return cli, BuildLocal, err
+	}
+
+	node, err := app.GetBuildNode(env)
+	if err != nil {
+		return nil, "", err
+	}
+	if !node.IsAvailable() {
+		return nil, "", fmt.Errorf("build node %s of application %s is not reachable", node.Name, app.Name)
+	}
+
+	ctx, cancel := node.getContext()
+	defer cancel()
+	cli, err := node.GetDockerClient(ctx, env)
+	return cli, node.Name, err
+}
@@ -23,8 +23,8 @@ package projectlib
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 
@@ -33,9 +33,10 @@ import (
 	"github.com/rs/xid"
 )
 
-// Build builds the image of an application or returns the preconfigured one if there is no Dockerfile
-func (app *Application) Build(env Environment) (string, error) {
-	appBasedir := filepath.Join(env.GetBaseDir(), "applications", app.Name)
+// Build builds the image of an application or returns the preconfigured one if there is no Dockerfile.
+// The build output is written to out.
+func (app *Application) Build(env Environment, out io.Writer) (string, error) {
+	appBasedir := app.getBaseDir(env)
 	dockerfilePath := filepath.Join(appBasedir, "Dockerfile")
 	if _, err := os.Stat(dockerfilePath); os.IsNotExist(err) {
 		if app.Image == "" {
@@ -44,16 +45,12 @@ func (app *Application) Build(env Environment) (string, error) {
 		return app.Image, nil
 	}
 
-	node, err := app.GetBuildNode(env)
+	client, buildHost, err := app.getBuildClient(env)
 	if err != nil {
 		return "", err
 	}
-
+	// like image pulls, builds take much longer than the node's timeout allows for checking on it
 	ctx := context.Background()
-	client, err := node.GetDockerClient(ctx, env)
-	if err != nil {
-		return "", err
-	}
 
 	fileinfo, err := ioutil.ReadDir(appBasedir)
 	if err != nil {
@@ -73,11 +70,12 @@ func (app *Application) Build(env Environment) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	log.Printf("Built build-context at %s", tarfile.Name())
+	logger := newLogger(out)
+	logger.Printf("Built build-context at %s", tarfile.Name())
 
 	imageVersion := xid.New().String()
-	imageName := env.GetRegistry().Host + "/" + app.Name + ":" + imageVersion
-	log.Printf("Building image %s on %s\n", imageName, node.Name)
+	imageName := app.getImageRepository(env) + ":" + imageVersion
+	logger.Printf("Building image %s on %s\n", imageName, buildHost)
 
 	dockerBuildContext, err := os.Open(tarfile.Name())
 	defer dockerBuildContext.Close()
@@ -89,15 +87,23 @@ func (app *Application) Build(env Environment) (string, error) {
 		BuildArgs:      app.BuildCfg.Args,
 		Tags:           []string{imageName},
 		NoCache:        true,
+		Platform:       app.BuildCfg.Platform,
+		Labels: map[string]string{
+			LabelProject:     env.GetName(),
+			LabelApplication: app.Name,
+		},
 	}
 	buildResponse, err := client.ImageBuild(ctx, dockerBuildContext, options)
 	if err != nil {
 		return "", err
 	}
 	defer buildResponse.Body.Close()
-	scanAndPrint(buildResponse.Body)
+	err = scanAndPrint(out, buildResponse.Body)
+	if err != nil {
+		return "", fmt.Errorf("error during image build: %s", err)
+	}
 
-	if !app.BuildCfg.DontPush {
+	if !app.BuildCfg.DontPush && app.GetTransfer(env) == TransferRegistry {
 		authString, err := env.GetRegistry().GetAuthString()
 		if err != nil {
 			return "", err
@@ -110,7 +116,10 @@ func (app *Application) Build(env Environment) (string, error) {
 			return "", err
 		}
 		defer pushResponse.Close()
-		scanAndPrint(pushResponse)
+		err = scanAndPrint(out, pushResponse)
+		if err != nil {
+			return "", fmt.Errorf("error while pushing image: %s", err)
+		}
 	}
 
 	return imageName, nil
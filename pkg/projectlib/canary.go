@@ -0,0 +1,124 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CanaryState tracks an image which was deployed to a subset of an application's nodes but not promoted yet
+type CanaryState struct {
+	Image   string   `yaml:"image"`
+	Nodes   []string `yaml:"nodes"`
+	Started string   `yaml:"started"`
+}
+
+// SelectCanaries picks the canary nodes among the deployment targets of an application. The selector is either
+// a node selector, e.g. .canary, or a percentage of the targets, e.g. 10%.
+func (app *Application) SelectCanaries(env Environment, selector string) ([]Node, error) {
+	targets, err := app.SelectDeploymentTargets(env)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+
+	if strings.HasSuffix(selector, "%") {
+		percentage, err := strconv.ParseFloat(strings.TrimSuffix(selector, "%"), 64)
+		if err != nil || percentage <= 0 || percentage > 100 {
+			return nil, fmt.Errorf("invalid canary percentage %s", selector)
+		}
+
+		count := int(math.Ceil(float64(len(targets)) * percentage / 100))
+		return targets[:count], nil
+	}
+
+	selected, err := env.SelectNodes(selector)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Node, 0)
+	for _, target := range targets {
+		for _, node := range selected {
+			if node.Name == target.Name {
+				result = append(result, target)
+				break
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("canary selector \"%s\" does not match any node application %s is deployed to", selector, app.Name)
+	}
+	return result, nil
+}
+
+// SelectPromotionTargets returns the deployment targets of an application which are not part of its canary
+func (app *Application) SelectPromotionTargets(env Environment, canary CanaryState) ([]Node, error) {
+	targets, err := app.SelectDeploymentTargets(env)
+	if err != nil {
+		return nil, err
+	}
+
+	isCanary := make(map[string]bool)
+	for _, name := range canary.Nodes {
+		isCanary[name] = true
+	}
+
+	result := make([]Node, 0)
+	for _, target := range targets {
+		if !isCanary[target.Name] {
+			result = append(result, target)
+		}
+	}
+	return result, nil
+}
+
+// StartCanary records that the locked image of an application is being tried on a set of nodes
+func (lock *RiotLock) StartCanary(app string, nodes []Node) {
+	if lock.Canaries == nil {
+		lock.Canaries = make(map[string]CanaryState)
+	}
+
+	names := make([]string, len(nodes))
+	for idx, node := range nodes {
+		names[idx] = node.Name
+	}
+	lock.Canaries[app] = CanaryState{
+		Image:   lock.Versions[app],
+		Nodes:   names,
+		Started: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// GetCanary returns the canary of an application, if there is one
+func (lock *RiotLock) GetCanary(app string) (CanaryState, bool) {
+	canary, ok := lock.Canaries[app]
+	return canary, ok
+}
+
+// EndCanary forgets the canary of an application
+func (lock *RiotLock) EndCanary(app string) {
+	delete(lock.Canaries, app)
+}
@@ -25,6 +25,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 )
 
 // CreateProject initiales a directory with the files and folders required for a riot project
@@ -39,7 +40,12 @@ func CreateProject(basedir string) error {
 		return fmt.Errorf("Project path exists but is not a directory: %s", basedir)
 	}
 
-	err = ioutil.WriteFile(path.Join(basedir, "environment.yaml"), []byte(`registry:
+	name, err := filepath.Abs(basedir)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path.Join(basedir, "environment.yaml"), []byte(`name: `+filepath.Base(name)+`
+registry:
   host: the-registry.local
 nodes:
 - name: myFirstNode
@@ -68,7 +74,10 @@ nodes:
 	}
 	err = ioutil.WriteFile(path.Join(basedir, "applications", "without-build", "application.yaml"), []byte(`deploysTo:
   - "#myFirstNode"
-image: alpine:3.7`), 0644)
+image: alpine:3.7
+run:
+  restart: unless-stopped
+  command: ["sh", "-c", "while true; do echo hello from {{ .Node.Name }}; sleep 60; done"]`), 0644)
 	if err != nil {
 		return err
 	}
@@ -84,7 +93,7 @@ func CreateApplication(basedir string, name string) error {
 	}
 	err = ioutil.WriteFile(path.Join(basedir, "applications", name, "Dockerfile"), []byte(`
 FROM alpine
-CMD ["echo", "hello"]
+CMD ["sh", "-c", "while true; do echo hello; sleep 60; done"]
     `), 0644)
 	if err != nil {
 		return err
@@ -96,6 +105,7 @@ build:
   args:
     foo: bar
 run:
+  restart: unless-stopped
   ports:
     8080: 8080
   volumes:
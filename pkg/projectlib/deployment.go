@@ -23,66 +23,327 @@ package projectlib
 import (
 	"context"
 	"fmt"
+	"io"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
 )
 
-// Deploy installs an application on a node
-func (app *Application) Deploy(node Node, env Environment, lock RiotLock) (*RiotLock, error) {
+// deploymentResult is what deploying an application on a node did
+type deploymentResult struct {
+	app         string
+	node        string
+	containerID string
+	// previousImage is the image the application ran before, empty if it was not running
+	previousImage string
+	// skipped is true if the node already ran the application as configured
+	skipped bool
+	// queued is true if the node was unreachable and the deployment of outcome.Image has to wait for it
+	queued bool
+	// dropped is true if a pending deployment was given up on
+	dropped bool
+	outcome DeploymentOutcome
+}
+
+// apply records the result of a deployment in a lock
+func (result *deploymentResult) apply(lock *RiotLock) {
+	if result.queued {
+		lock.QueueDeployment(result.node, result.app, result.outcome.Image)
+		return
+	}
+	lock.ClearPending(result.node, result.app)
+	if result.dropped {
+		return
+	}
+	if result.skipped {
+		lock.AddDeployment(result.app, result.node, result.containerID)
+		return
+	}
+	if result.outcome.Status == OutcomeDeployed {
+		lock.AddDeployment(result.app, result.node, result.containerID)
+	}
+	lock.SetOutcome(result.app, result.node, result.outcome)
+}
+
+// deployImage installs an image of an application on a node without modifying the lock. If the deployment
+// got as far as replacing the previous container, a result is returned even if the deployment failed.
+// Unless force is true, nothing happens if the application already runs with the same image and configuration.
+// Progress is written to out.
+func (app *Application) deployImage(node Node, env Environment, lock RiotLock, imageName string, force bool, out io.Writer) (*deploymentResult, error) {
+	if err := checkProjectName(env); err != nil {
+		return nil, err
+	}
+	// the node's timeout only applies to checking the node, pulling the image may take much longer
 	ctx := context.Background()
-	client, err := node.GetDockerClient(ctx, env)
+	probeCtx, cancel := node.getContext()
+	defer cancel()
+	client, err := node.GetDockerClient(probeCtx, env)
+	if err != nil {
+		return nil, err
+	}
+
+	config, hostConfig, err := app.getContainerConfig(node, env, lock, imageName)
 	if err != nil {
 		return nil, err
 	}
 
-	imageName, ok := lock.Versions[app.Name]
-	if !ok {
-		return nil, fmt.Errorf("application %s has no riot.lock entry. Please run riot build", app.Name)
+	logger := newLogger(out)
+	if !force {
+		current, err := findUpToDateContainer(probeCtx, client, node, env, app, config.Labels[LabelFingerprint], isOneShot(hostConfig))
+		if err != nil {
+			return nil, err
+		}
+		if current != nil {
+			logger.Printf("\"%s\" on \"%s\" is up to date\n", app.Name, node.Name)
+			return &deploymentResult{
+				app:         app.Name,
+				node:        node.Name,
+				containerID: current.ID,
+				skipped:     true,
+			}, nil
+		}
+	}
+
+	err = app.transferImage(ctx, client, node, env, imageName, out)
+	if err != nil {
+		return nil, err
 	}
 
-	out, err := client.ImagePull(ctx, imageName, types.ImagePullOptions{})
+	containerName := app.getContainerName()
+	previous, err := node.findContainers(ctx, client, env, app.Name, true)
 	if err != nil {
 		return nil, err
 	}
-	scanAndPrint(out)
 
-	containerID, ok := lock.GetDeployment(app.Name, node.Name)
-	if ok {
-		err := client.ContainerStop(ctx, containerID, nil)
+	// anything else using the name was not deployed by riot
+	existing, err := findContainerByName(ctx, client, containerName)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range existing {
+		if c.Labels[LabelProject] == env.GetName() && c.Labels[LabelApplication] == app.Name {
+			continue
+		}
+
+		err := client.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{Force: true})
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	hostConfig := container.HostConfig{
-		Privileged: app.RunCfg.Priviliged,
+	err = node.ensureNetworks(ctx, client, env, app.RunCfg.Networks)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &deploymentResult{
+		app:  app.Name,
+		node: node.Name,
 	}
-	if len(app.RunCfg.Volumes) > 0 {
-		mounts := make([]mount.Mount, 0)
-		for source, target := range app.RunCfg.Volumes {
-			mounts = append(mounts, mount.Mount{
-				Source: source,
-				Target: target,
-			})
+	stopped := make([]string, 0)
+	renamed := make([]string, 0)
+	rollback := func(newContainerID string, cause error) (*deploymentResult, error) {
+		result.outcome = DeploymentOutcome{
+			Image:  imageName,
+			Status: OutcomeRolledBack,
+			Time:   time.Now().UTC().Format(time.RFC3339),
+			Error:  cause.Error(),
+		}
+
+		err := restoreContainers(ctx, client, newContainerID, stopped, renamed, containerName)
+		if err != nil {
+			result.outcome.Status = OutcomeFailed
+			return result, fmt.Errorf("deployment of %s on %s failed: %s. Rolling back failed as well: %s", app.Name, node.Name, cause, err)
 		}
-		hostConfig.Mounts = mounts
+		return result, fmt.Errorf("deployment of %s on %s failed and was rolled back: %s", app.Name, node.Name, cause)
 	}
 
-	resp, err := client.ContainerCreate(ctx, &container.Config{
-		Image: imageName,
-	}, &hostConfig, nil, "")
+	// only what was actually stopped or renamed is undone by a rollback
+	for _, c := range previous {
+		if c.State == "running" {
+			result.previousImage = c.Labels[LabelVersion]
+			err := client.ContainerStop(ctx, c.ID, nil)
+			if err != nil {
+				return rollback("", err)
+			}
+			stopped = append(stopped, c.ID)
+		}
+		if hasContainerName(c, containerName) {
+			// move the superseded container out of the way so that the new one can take its name
+			err := client.ContainerRename(ctx, c.ID, containerName+"-"+c.ID[:12])
+			if err != nil {
+				return rollback("", err)
+			}
+			renamed = append(renamed, c.ID)
+		}
+	}
+
+	resp, err := client.ContainerCreate(ctx, config, hostConfig, app.getNetworkingConfig(), containerName)
 	if err != nil {
-		return nil, err
+		return rollback("", err)
 	}
 
-	err = client.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{})
+	err = app.connectNetworks(ctx, client, resp.ID)
+	if err == nil {
+		err = client.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{})
+	}
+	if err == nil {
+		err = waitForContainer(ctx, client, resp.ID, app.RunCfg.Healthcheck.Wait, isOneShot(hostConfig), app.RunCfg.getStartTimeout())
+	}
+	if err != nil {
+		return rollback(resp.ID, err)
+	}
+
+	removeOptions := types.ContainerRemoveOptions{
+		RemoveVolumes: app.RunCfg.RemoveVolumes,
+	}
+	for _, c := range previous {
+		err := client.ContainerRemove(ctx, c.ID, removeOptions)
+		if err != nil {
+			logger.Printf("Unable to remove superseded container %s on %s: %s\n", c.ID[:12], node.Name, err)
+		}
+	}
+	if _, err := node.removeUnusedNetworks(ctx, client, env, false); err != nil {
+		logger.Printf("Unable to remove unused networks on %s: %s\n", node.Name, err)
+	}
+
+	result.containerID = resp.ID
+	result.outcome = DeploymentOutcome{
+		Image:  imageName,
+		Status: OutcomeDeployed,
+		Time:   time.Now().UTC().Format(time.RFC3339),
+	}
+	return result, nil
+}
+
+// waitForContainer waits until a container is running and, if waitHealthy is true, until its healthcheck passes.
+// If allowExit is true a container which exited with code 0 counts as started successfully.
+func waitForContainer(ctx context.Context, client *client.Client, containerID string, waitHealthy bool, allowExit bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		info, err := client.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return err
+		}
+
+		state := info.State
+		if state.Status == "exited" && state.ExitCode == 0 && allowExit && !waitHealthy {
+			return nil
+		}
+		if state.Status == "exited" || state.Status == "dead" {
+			return fmt.Errorf("container exited with code %d", state.ExitCode)
+		}
+		if state.Running && !state.Restarting {
+			if !waitHealthy {
+				return nil
+			} else if state.Health == nil {
+				return fmt.Errorf("container has no healthcheck to wait for")
+			} else if state.Health.Status == types.Healthy {
+				return nil
+			} else if state.Health.Status == types.Unhealthy {
+				return fmt.Errorf("container is unhealthy")
+			}
+		}
+
+		if time.Now().After(deadline) {
+			if waitHealthy {
+				return fmt.Errorf("container did not become healthy within %s", timeout)
+			}
+			return fmt.Errorf("container did not come up within %s", timeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// restoreContainers removes a failed container, gives the renamed containers their name back and restarts the
+// stopped ones
+func restoreContainers(ctx context.Context, client *client.Client, failedContainerID string, stopped []string, renamed []string, containerName string) error {
+	if failedContainerID != "" {
+		err := client.ContainerRemove(ctx, failedContainerID, types.ContainerRemoveOptions{Force: true})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range renamed {
+		err := client.ContainerRename(ctx, id, containerName)
+		if err != nil {
+			return err
+		}
+	}
+	for _, id := range stopped {
+		err := client.ContainerStart(ctx, id, types.ContainerStartOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findUpToDateContainer returns the container of an application on a node if it was created with the given
+// fingerprint and is running, or, if oneShot is true, exited cleanly. It returns nil if there is no such container.
+func findUpToDateContainer(ctx context.Context, client *client.Client, node Node, env Environment, app *Application, fingerprint string, oneShot bool) (*types.Container, error) {
+	containers, err := node.findContainers(ctx, client, env, app.Name, true)
 	if err != nil {
 		return nil, err
 	}
 
-	lock.AddDeployment(app.Name, node.Name, resp.ID)
+	for _, c := range containers {
+		if !hasContainerName(c, app.getContainerName()) || c.Labels[LabelFingerprint] != fingerprint {
+			continue
+		}
+		if c.State == "running" {
+			return &c, nil
+		}
+		if oneShot {
+			completed, err := hasCompleted(ctx, client, c)
+			if err != nil {
+				return nil, err
+			} else if completed {
+				return &c, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// isOneShot returns true if a container with this host configuration may be a one-shot job, i.e. if it has no
+// restart policy. Such a container is done once it exits cleanly.
+func isOneShot(hostConfig *container.HostConfig) bool {
+	return hostConfig.RestartPolicy.Name == "" || hostConfig.RestartPolicy.Name == "no"
+}
+
+// hasCompleted returns true if a container exited with code 0
+func hasCompleted(ctx context.Context, client *client.Client, c types.Container) (bool, error) {
+	if c.State != "exited" {
+		return false, nil
+	}
+
+	info, err := client.ContainerInspect(ctx, c.ID)
+	if err != nil {
+		return false, err
+	}
+	return info.State.ExitCode == 0, nil
+}
+
+func hasContainerName(c types.Container, name string) bool {
+	for _, n := range c.Names {
+		if n == "/"+name {
+			return true
+		}
+	}
+	return false
+}
 
-	return &lock, nil
+// findContainerByName lists all containers (running or not) with exactly the given name
+func findContainerByName(ctx context.Context, client *client.Client, name string) ([]types.Container, error) {
+	args := filters.NewArgs()
+	args.Add("name", "^/"+name+"$")
+	return client.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: args,
+	})
 }
@@ -65,34 +65,32 @@ func (node *Node) getDockerHost() string {
 	return fmt.Sprintf("tcp://%s:2376", node.Host)
 }
 
-func scanAndPrint(reader io.Reader) (bool, error) {
+// scanAndPrint prints the JSON progress stream of the Docker API and returns the error reported in it, if any
+func scanAndPrint(out io.Writer, reader io.Reader) error {
 	scanner := bufio.NewScanner(reader)
-
-	foundError := false
 	for scanner.Scan() {
 		t := scanner.Text()
 		b := []byte(t)
 		var f interface{}
 		err := json.Unmarshal(b, &f)
 		if err != nil {
-			fmt.Println(t)
+			fmt.Fprintln(out, t)
 		} else {
 			m := f.(map[string]interface{})
 			if status, ok := m["stream"]; ok {
-				fmt.Print(status)
+				fmt.Fprint(out, status)
 			} else if status, ok := m["status"]; ok {
-				fmt.Println(status)
+				fmt.Fprintln(out, status)
 			} else if err, ok := m["errorDetail"]; ok {
-				foundError = true
-				log.Fatalf("Error during image build: %s", err)
+				if detail, ok := err.(map[string]interface{}); ok && detail["message"] != nil {
+					return fmt.Errorf("%s", detail["message"])
+				}
+				return fmt.Errorf("%s", err)
 			} else {
-				fmt.Println(t)
+				fmt.Fprintln(out, t)
 			}
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return false, err
-	}
-	return foundError, nil
+	return scanner.Err()
 }
@@ -0,0 +1,173 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// getEnvVars collects the environment variables of an application on a node. Variables from env files are
+// overridden by those in env, which in turn are overridden by the node specific ones in nodeEnv.
+func (app *Application) getEnvVars(node Node, env Environment) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, fn := range app.RunCfg.EnvFile {
+		if !filepath.IsAbs(fn) {
+			fn = filepath.Join(app.getBaseDir(env), fn)
+		}
+
+		vars, err := loadEnvFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range vars {
+			result[name] = value
+		}
+	}
+	for name, value := range app.RunCfg.Env {
+		result[name] = value
+	}
+	for name, value := range app.RunCfg.NodeEnv[node.Name] {
+		result[name] = value
+	}
+	return result, nil
+}
+
+// getEnvironment computes the container environment of an application on a node. References to other
+// variables in the form of $NAME or ${NAME} are expanded, $$ stands for a literal $. A $ which is not followed by
+// a valid variable name is kept as is.
+func (app *Application) getEnvironment(node Node, env Environment) ([]string, error) {
+	vars, err := app.getEnvVars(node, env)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(vars))
+	for name, value := range vars {
+		value = expandVariables(value, func(ref string) string {
+			return vars[ref]
+		})
+		result = append(result, name+"="+value)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// findUndefinedVariables returns the names of all variables referenced in value which are not defined in vars
+func findUndefinedVariables(value string, vars map[string]string) []string {
+	result := make([]string, 0)
+	expandVariables(value, func(ref string) string {
+		if _, ok := vars[ref]; !ok {
+			result = append(result, ref)
+		}
+		return ""
+	})
+	return result
+}
+
+// expandVariables replaces $NAME and ${NAME} in value using lookup and $$ with $. Unlike os.Expand it leaves a $
+// alone unless it is followed by a valid variable name.
+func expandVariables(value string, lookup func(name string) string) string {
+	var result strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) {
+			result.WriteByte(value[i])
+			continue
+		}
+
+		rest := value[i+1:]
+		if rest[0] == '$' {
+			result.WriteByte('$')
+			i++
+		} else if rest[0] == '{' {
+			end := strings.IndexByte(rest, '}')
+			if end < 0 || !isVariableName(rest[1:end]) {
+				result.WriteByte('$')
+				continue
+			}
+			result.WriteString(lookup(rest[1:end]))
+			i += end + 1
+		} else {
+			end := 0
+			for end < len(rest) && isVariableName(rest[:end+1]) {
+				end++
+			}
+			if end == 0 {
+				result.WriteByte('$')
+				continue
+			}
+			result.WriteString(lookup(rest[:end]))
+			i += end
+		}
+	}
+	return result.String()
+}
+
+// isVariableName checks if name is a letter or underscore followed by letters, digits and underscores
+func isVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for idx, c := range name {
+		isLetter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isLetter && (idx == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// loadEnvFile reads a file of NAME=VALUE lines. Empty lines and lines starting with # are ignored.
+func loadEnvFile(fn string) (map[string]string, error) {
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNr := 1; scanner.Scan(); lineNr++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		segments := strings.SplitN(line, "=", 2)
+		if len(segments) != 2 || strings.TrimSpace(segments[0]) == "" {
+			return nil, fmt.Errorf("%s:%d: expected NAME=VALUE", fn, lineNr)
+		}
+
+		value := strings.TrimSpace(segments[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		result[strings.TrimSpace(segments[0])] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -38,7 +38,9 @@ import (
 
 // Environment is the core configuration of a riot project
 type Environment interface {
+	GetName() string
 	GetRegistry() RegistryCfg
+	GetTransfer() string
 	GetNodes() []Node
 	GetApplications() ([]Application, error)
 	GetApplication(name string) (Application, error)
@@ -51,7 +53,9 @@ type Environment interface {
 
 type environment struct {
 	basedir  string
+	Name     string      `yaml:"name,omitempty"`
 	Registry RegistryCfg `yaml:"registry"`
+	Transfer string      `yaml:"transfer,omitempty"`
 	Nodes    []Node      `yaml:"nodes"`
 }
 
@@ -62,11 +66,17 @@ type RegistryCfg struct {
 	Password string `yaml:"password"`
 }
 
-// Node represents a single device on which we can deploy an application to
+const defaultAvailabilityTimeout = 1 * time.Second
+
+// Node represents a single device on which we can deploy an application to. Its timeout limits how long checking
+// on the node may take, the availability check defaults to a second.
 type Node struct {
-	Name   string   `yaml:"name"`
-	Host   string   `yaml:"host"`
-	Labels []string `yaml:"labels"`
+	Name     string            `yaml:"name"`
+	Host     string            `yaml:"host"`
+	Labels   []string          `yaml:"labels"`
+	Vars     map[string]string `yaml:"vars,omitempty"`
+	Capacity NodeCapacity      `yaml:"capacity,omitempty"`
+	Timeout  time.Duration     `yaml:"timeout,omitempty"`
 }
 
 // GetAuthString computes the base64 authorization string needed for docker registry requests
@@ -84,10 +94,20 @@ func (reg RegistryCfg) GetAuthString() (string, error) {
 	return authBase64, nil
 }
 
+// GetName returns the project name riot recognises its containers by, empty if environment.yaml sets none
+func (env *environment) GetName() string {
+	return env.Name
+}
+
 func (env *environment) GetRegistry() RegistryCfg {
 	return env.Registry
 }
 
+// GetTransfer returns how images get to the nodes unless an application says otherwise
+func (env *environment) GetTransfer() string {
+	return env.Transfer
+}
+
 // Nodes returns all nodes configured in an environment
 func (env *environment) GetNodes() []Node {
 	return env.Nodes
@@ -172,10 +192,19 @@ func LoadEnv(basedir string) (Environment, error) {
 	return &result, nil
 }
 
-// IsAvailable checks if a node is available for container deployment
+// IsAvailable checks if a node is available for container deployment, waiting for the node's timeout at most
 func (node *Node) IsAvailable() bool {
-	_, err := net.DialTimeout("tcp", node.Host+":2376", time.Duration(1)*time.Second)
-	return err == nil
+	timeout := node.Timeout
+	if timeout <= 0 {
+		timeout = defaultAvailabilityTimeout
+	}
+
+	conn, err := net.DialTimeout("tcp", node.Host+":2376", timeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
 }
 
 func (env *environment) SelectNodes(selector string) ([]Node, error) {
@@ -0,0 +1,157 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// AppHealthcheck configures how docker checks that an application is working. A single command is run
+// using the container's shell, a list of arguments is executed directly.
+type AppHealthcheck struct {
+	Command     StringList    `yaml:"command,omitempty"`
+	Interval    time.Duration `yaml:"interval,omitempty"`
+	Timeout     time.Duration `yaml:"timeout,omitempty"`
+	Retries     int           `yaml:"retries,omitempty"`
+	StartPeriod time.Duration `yaml:"startPeriod,omitempty"`
+	// Disable turns off any healthcheck defined by the image
+	Disable bool `yaml:"disable,omitempty"`
+	// Wait makes deployments wait until the container is healthy and roll back otherwise
+	Wait bool `yaml:"wait,omitempty"`
+}
+
+// the defaults docker uses for healthcheck settings which are not set
+const (
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 30 * time.Second
+	defaultHealthRetries  = 3
+)
+
+// getInterval returns the time between two health probes
+func (check *AppHealthcheck) getInterval() time.Duration {
+	if check.Interval == 0 {
+		return defaultHealthInterval
+	}
+	return check.Interval
+}
+
+// getDecisionTime returns how long docker may take at most to find a container healthy or unhealthy
+func (check *AppHealthcheck) getDecisionTime() time.Duration {
+	timeout := check.Timeout
+	if timeout == 0 {
+		timeout = defaultHealthTimeout
+	}
+	retries := check.Retries
+	if retries == 0 {
+		retries = defaultHealthRetries
+	}
+	return check.StartPeriod + (check.getInterval()+timeout)*time.Duration(retries)
+}
+
+// AppStatus describes the state of an application on a node
+type AppStatus struct {
+	Running bool
+	// Health is the docker health status of the container, empty if it has no healthcheck
+	Health string
+	// Image is the image the running container was created from
+	Image string
+}
+
+// IsHealthy returns true if the application is running and not known to be unhealthy
+func (status AppStatus) IsHealthy() bool {
+	return status.Running && (status.Health == "" || status.Health == types.Healthy)
+}
+
+// getHealthConfig converts the healthcheck into its docker configuration
+func (check *AppHealthcheck) getHealthConfig() (*container.HealthConfig, error) {
+	if check.Disable {
+		if len(check.Command) > 0 || check.Wait {
+			return nil, fmt.Errorf("a disabled healthcheck cannot have a command or be waited for")
+		}
+		return &container.HealthConfig{Test: []string{"NONE"}}, nil
+	}
+	if check.Retries < 0 || check.Interval < 0 || check.Timeout < 0 || check.StartPeriod < 0 {
+		return nil, fmt.Errorf("healthcheck retries and durations must not be negative")
+	}
+	if len(check.Command) == 0 {
+		if check.Interval != 0 || check.Timeout != 0 || check.Retries != 0 || check.StartPeriod != 0 {
+			return nil, fmt.Errorf("healthcheck settings require a command")
+		}
+		// use the healthcheck of the image, if any
+		return nil, nil
+	}
+
+	var test []string
+	if len(check.Command) == 1 {
+		test = []string{"CMD-SHELL", check.Command[0]}
+	} else {
+		test = append([]string{"CMD"}, check.Command...)
+	}
+	return &container.HealthConfig{
+		Test:        test,
+		Interval:    check.Interval,
+		Timeout:     check.Timeout,
+		Retries:     check.Retries,
+		StartPeriod: check.StartPeriod,
+	}, nil
+}
+
+// GetAppStatus checks if an application is currently running on a node, which image it runs and how healthy it is
+func (node Node) GetAppStatus(app *Application, env Environment) (AppStatus, error) {
+	ctx, cancel := node.getContext()
+	defer cancel()
+	client, err := node.GetDockerClient(ctx, env)
+	if err != nil {
+		return AppStatus{}, err
+	}
+
+	containers, err := node.findContainers(ctx, client, env, app.Name, false)
+	if err != nil {
+		return AppStatus{}, err
+	}
+	if len(containers) == 0 {
+		return AppStatus{}, nil
+	}
+
+	// a superseded container only runs alongside the current one during a deployment
+	current := containers[0]
+	for _, c := range containers {
+		if hasContainerName(c, app.getContainerName()) {
+			current = c
+			break
+		}
+	}
+
+	info, err := client.ContainerInspect(ctx, current.ID)
+	if err != nil {
+		return AppStatus{}, err
+	}
+
+	status := AppStatus{Running: info.State.Running, Image: current.Labels[LabelVersion]}
+	if info.State.Health != nil {
+		status.Health = info.State.Health.Status
+	}
+	return status, nil
+}
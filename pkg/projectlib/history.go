@@ -0,0 +1,118 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// BuildHistory keeps the images built for each application of a project, oldest first
+type BuildHistory struct {
+	Builds map[string][]string `yaml:"builds"`
+}
+
+// LoadHistory loads the riot.history file of a project. A project without history has an empty one.
+func LoadHistory(basedir string) (BuildHistory, error) {
+	fn := path.Join(basedir, "riot.history")
+	_, err := os.Stat(fn)
+	if os.IsNotExist(err) {
+		return BuildHistory{Builds: make(map[string][]string)}, nil
+	}
+
+	yamlFile, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return BuildHistory{}, err
+	}
+
+	var result BuildHistory
+	err = yaml.Unmarshal(yamlFile, &result)
+	if err != nil {
+		return BuildHistory{}, err
+	}
+	if result.Builds == nil {
+		result.Builds = make(map[string][]string)
+	}
+
+	return result, nil
+}
+
+// Save stores the build history in a project
+func (history BuildHistory) Save(basedir string) error {
+	data, err := yaml.Marshal(history)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path.Join(basedir, "riot.history"), data, 0644)
+}
+
+// Add records a new build of an application
+func (history *BuildHistory) Add(app string, imageName string) {
+	if history.Builds == nil {
+		history.Builds = make(map[string][]string)
+	}
+
+	builds := history.Builds[app]
+	if len(builds) > 0 && builds[len(builds)-1] == imageName {
+		// apps without a Dockerfile use the same image on every build
+		return
+	}
+	history.Builds[app] = append(builds, imageName)
+}
+
+// FindVersion finds a build of an application either by its full image name or by its version tag
+func (history BuildHistory) FindVersion(app string, version string) (string, error) {
+	for _, imageName := range history.Builds[app] {
+		if imageName == version || strings.HasSuffix(imageName, ":"+version) {
+			return imageName, nil
+		}
+	}
+	return "", fmt.Errorf("application %s has no build with version %s", app, version)
+}
+
+// Previous returns the build of an application which came before the given image
+func (history BuildHistory) Previous(app string, imageName string) (string, error) {
+	builds := history.Builds[app]
+	for idx := len(builds) - 1; idx > 0; idx-- {
+		if builds[idx] == imageName {
+			return builds[idx-1], nil
+		}
+	}
+	return "", fmt.Errorf("application %s has no build before %s", app, imageName)
+}
+
+// Recent returns the last count builds of an application, newest last
+func (history BuildHistory) Recent(app string, count int) []string {
+	builds := history.Builds[app]
+	if count < 0 {
+		count = 0
+	}
+	if len(builds) > count {
+		builds = builds[len(builds)-count:]
+	}
+	return builds
+}
@@ -0,0 +1,89 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// LabelProject names the riot project a container belongs to
+	LabelProject = "riot.project"
+	// LabelApplication names the application a container runs
+	LabelApplication = "riot.application"
+	// LabelNode names the node a container was deployed to
+	LabelNode = "riot.node"
+	// LabelVersion is the image a container was deployed from
+	LabelVersion = "riot.version"
+	// LabelLockHash identifies the riot.lock a container was deployed with
+	LabelLockHash = "riot.lock-hash"
+	// LabelDeployedAt is the time at which a container was deployed
+	LabelDeployedAt = "riot.deployed-at"
+	// LabelFingerprint identifies the image and run configuration a container was created with
+	LabelFingerprint = "riot.fingerprint"
+)
+
+// getContainerLabels computes the labels riot stamps on every container it deploys
+func (app *Application) getContainerLabels(node Node, env Environment, lock RiotLock, imageName string, fingerprint string) map[string]string {
+	return map[string]string{
+		LabelProject:     env.GetName(),
+		LabelApplication: app.Name,
+		LabelNode:        node.Name,
+		LabelVersion:     imageName,
+		LabelLockHash:    lock.Hash(),
+		LabelDeployedAt:  time.Now().UTC().Format(time.RFC3339),
+		LabelFingerprint: fingerprint,
+	}
+}
+
+// findContainers lists the riot-managed containers on a node. If app is not empty only containers of that application are listed.
+// Unless all is true, only running containers are returned.
+func (node *Node) findContainers(ctx context.Context, client *client.Client, env Environment, app string, all bool) ([]types.Container, error) {
+	if err := checkProjectName(env); err != nil {
+		return nil, err
+	}
+
+	args := filters.NewArgs()
+	args.Add("label", LabelProject+"="+env.GetName())
+	args.Add("label", LabelNode+"="+node.Name)
+	if app != "" {
+		args.Add("label", LabelApplication+"="+app)
+	}
+
+	return client.ContainerList(ctx, types.ContainerListOptions{
+		All:     all,
+		Filters: args,
+	})
+}
+
+// checkProjectName makes sure a project has a name, as without one riot cannot tell its containers from others
+func checkProjectName(env Environment) error {
+	if env.GetName() == "" {
+		return fmt.Errorf("environment.yaml has no name. Please add one, riot uses it to recognise the containers of this project")
+	}
+	return nil
+}
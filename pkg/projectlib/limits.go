@@ -0,0 +1,82 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	units "github.com/docker/go-units"
+)
+
+// AppLimits restricts the resources an application may use on a node
+type AppLimits struct {
+	Memory     string `yaml:"memory,omitempty"`
+	MemorySwap string `yaml:"memorySwap,omitempty"`
+	CPUShares  int64  `yaml:"cpuShares,omitempty"`
+	CPUPeriod  int64  `yaml:"cpuPeriod,omitempty"`
+	CPUQuota   int64  `yaml:"cpuQuota,omitempty"`
+	CpusetCpus string `yaml:"cpuset,omitempty"`
+	PidsLimit  int64  `yaml:"pids,omitempty"`
+}
+
+// NodeCapacity describes the resources available on a node
+type NodeCapacity struct {
+	Memory string `yaml:"memory,omitempty"`
+}
+
+// getResources converts the limits into docker container resources
+func (limits *AppLimits) getResources() (container.Resources, error) {
+	memory, err := parseMemory(limits.Memory)
+	if err != nil {
+		return container.Resources{}, fmt.Errorf("invalid memory limit %s: %s", limits.Memory, err)
+	}
+	memorySwap, err := parseMemory(limits.MemorySwap)
+	if err != nil {
+		return container.Resources{}, fmt.Errorf("invalid memory+swap limit %s: %s", limits.MemorySwap, err)
+	}
+	if memorySwap > 0 && memorySwap < memory {
+		return container.Resources{}, fmt.Errorf("memory+swap limit %s must not be lower than the memory limit %s", limits.MemorySwap, limits.Memory)
+	}
+	if memorySwap != 0 && memory == 0 {
+		return container.Resources{}, fmt.Errorf("memory+swap limit %s requires a memory limit", limits.MemorySwap)
+	}
+
+	return container.Resources{
+		Memory:     memory,
+		MemorySwap: memorySwap,
+		CPUShares:  limits.CPUShares,
+		CPUPeriod:  limits.CPUPeriod,
+		CPUQuota:   limits.CPUQuota,
+		CpusetCpus: limits.CpusetCpus,
+		PidsLimit:  limits.PidsLimit,
+	}, nil
+}
+
+// parseMemory parses a human readable amount of memory, e.g. 64m. -1 stands for unlimited.
+func parseMemory(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	} else if size == "-1" {
+		return -1, nil
+	}
+	return units.RAMInBytes(size)
+}
@@ -0,0 +1,181 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// getNetworkMode resolves the network mode of an application. The container:<app> mode shares the network
+// stack of another application's container. Applications on user-defined networks start on the first of them.
+func (run *AppRun) getNetworkMode() (container.NetworkMode, error) {
+	mode := run.NetworkMode
+	if len(run.Networks) > 0 {
+		if mode != "" && mode != "bridge" {
+			return "", fmt.Errorf("invalid network mode %s: user-defined networks require the bridge network mode", mode)
+		}
+		return container.NetworkMode(run.Networks[0]), nil
+	}
+
+	switch {
+	case mode == "" || mode == "bridge" || mode == "host" || mode == "none":
+		return container.NetworkMode(mode), nil
+	case strings.HasPrefix(mode, "container:") && len(mode) > len("container:"):
+		other := Application{Name: strings.TrimPrefix(mode, "container:")}
+		return container.NetworkMode("container:" + other.getContainerName()), nil
+	default:
+		return "", fmt.Errorf("invalid network mode %s: must be one of bridge, host, none or container:<app>", mode)
+	}
+}
+
+// getNetworkingConfig connects the container of an application to the first of its user-defined networks,
+// where other containers can reach it by the application name
+func (app *Application) getNetworkingConfig() *network.NetworkingConfig {
+	if len(app.RunCfg.Networks) == 0 {
+		return nil
+	}
+
+	return &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			app.RunCfg.Networks[0]: app.getEndpointSettings(),
+		},
+	}
+}
+
+func (app *Application) getEndpointSettings() *network.EndpointSettings {
+	return &network.EndpointSettings{
+		Aliases: []string{app.Name},
+	}
+}
+
+// connectNetworks connects a container to all but the first user-defined network of an application
+func (app *Application) connectNetworks(ctx context.Context, client *client.Client, containerID string) error {
+	for idx, name := range app.RunCfg.Networks {
+		if idx == 0 {
+			continue
+		}
+
+		err := client.NetworkConnect(ctx, name, containerID, app.getEndpointSettings())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureNetworks creates the user-defined networks on a node which do not exist yet
+func (node *Node) ensureNetworks(ctx context.Context, client *client.Client, env Environment, names []string) error {
+	for _, name := range names {
+		args := filters.NewArgs()
+		args.Add("name", name)
+		existing, err := client.NetworkList(ctx, types.NetworkListOptions{Filters: args})
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, n := range existing {
+			// the name filter matches substrings
+			if n.Name == name {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		_, err = client.NetworkCreate(ctx, name, types.NetworkCreate{
+			CheckDuplicate: true,
+			Driver:         "bridge",
+			Labels: map[string]string{
+				LabelProject: env.GetName(),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeUnusedNetworks removes the networks riot created on a node which no container, running or stopped,
+// references anymore. If dryRun is true, the networks are only returned.
+func (node *Node) removeUnusedNetworks(ctx context.Context, client *client.Client, env Environment, dryRun bool) ([]types.NetworkResource, error) {
+	args := filters.NewArgs()
+	args.Add("label", LabelProject+"="+env.GetName())
+	networks, err := client.NetworkList(ctx, types.NetworkListOptions{Filters: args})
+	if err != nil {
+		return nil, err
+	}
+
+	// stopped containers have no endpoints, so the networks they need only show up in their configuration
+	containers, err := client.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[string]bool)
+	for _, c := range containers {
+		referenced[c.HostConfig.NetworkMode] = true
+		if c.NetworkSettings == nil {
+			continue
+		}
+		for name, endpoint := range c.NetworkSettings.Networks {
+			referenced[name] = true
+			if endpoint != nil {
+				referenced[endpoint.NetworkID] = true
+			}
+		}
+	}
+
+	result := make([]types.NetworkResource, 0)
+	for _, n := range networks {
+		if referenced[n.Name] || referenced[n.ID] {
+			continue
+		}
+
+		// network lists do not contain the connected containers
+		info, err := client.NetworkInspect(ctx, n.ID, types.NetworkInspectOptions{})
+		if err != nil {
+			return result, err
+		}
+		if len(info.Containers) > 0 {
+			continue
+		}
+
+		if !dryRun {
+			err := client.NetworkRemove(ctx, n.ID)
+			if err != nil {
+				return result, err
+			}
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
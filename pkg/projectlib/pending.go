@@ -0,0 +1,157 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// PendingDeployment is a deployment which could not happen because its node was unreachable
+type PendingDeployment struct {
+	Application string `yaml:"application"`
+	Image       string `yaml:"image"`
+	Queued      string `yaml:"queued"`
+}
+
+// QueueDeployment remembers to deploy an image of an application once a node is reachable again. It replaces
+// any deployment of the application already pending on the node.
+func (lock *RiotLock) QueueDeployment(node string, app string, imageName string) {
+	if lock.Pending == nil {
+		lock.Pending = make(map[string][]PendingDeployment)
+	}
+
+	pending := PendingDeployment{
+		Application: app,
+		Image:       imageName,
+		Queued:      time.Now().UTC().Format(time.RFC3339),
+	}
+	lock.ClearPending(node, app)
+	lock.Pending[node] = append(lock.Pending[node], pending)
+}
+
+// GetPending returns the deployments waiting for a node to become reachable
+func (lock *RiotLock) GetPending(node string) []PendingDeployment {
+	return lock.Pending[node]
+}
+
+// getPendingOf returns the deployments of the given applications, or of all applications if apps is empty,
+// waiting for a node to become reachable
+func (lock *RiotLock) getPendingOf(node string, apps []string) []PendingDeployment {
+	if len(apps) == 0 {
+		return lock.GetPending(node)
+	}
+
+	result := make([]PendingDeployment, 0)
+	for _, pending := range lock.GetPending(node) {
+		if containsString(apps, pending.Application) {
+			result = append(result, pending)
+		}
+	}
+	return result
+}
+
+// ClearPending forgets a pending deployment of an application on a node
+func (lock *RiotLock) ClearPending(node string, app string) {
+	remaining := make([]PendingDeployment, 0)
+	for _, pending := range lock.Pending[node] {
+		if pending.Application != app {
+			remaining = append(remaining, pending)
+		}
+	}
+
+	if len(remaining) == 0 {
+		delete(lock.Pending, node)
+	} else {
+		lock.Pending[node] = remaining
+	}
+}
+
+// DrainPending deploys what is pending on the nodes which are reachable again, at most parallel nodes at a time.
+// If apps is not empty, only the pending deployments of these applications are deployed. The lock is saved afterwards.
+func DrainPending(env Environment, lock RiotLock, apps []string, parallel int) (RiotLock, []error) {
+	nodes := make([]Node, 0)
+	for _, node := range env.GetNodes() {
+		if len(lock.getPendingOf(node.Name, apps)) > 0 {
+			nodes = append(nodes, node)
+		}
+	}
+
+	results := make([][]*deploymentResult, len(nodes))
+	tasks := make([]Task, len(nodes))
+	for idx, node := range nodes {
+		idx, node := idx, node
+		tasks[idx] = func(out io.Writer) error {
+			if !node.IsAvailable() {
+				newLogger(out).Printf("Node %s is still unreachable, keeping %d pending deployments\n", node.Name, len(lock.getPendingOf(node.Name, apps)))
+				return nil
+			}
+
+			var err error
+			results[idx], err = node.drainPending(env, lock, apps, out)
+			return err
+		}
+	}
+	errors := RunParallel(parallel, os.Stderr, tasks)
+
+	for idx := range nodes {
+		for _, result := range results[idx] {
+			result.apply(&lock)
+		}
+	}
+	if len(nodes) > 0 {
+		lock.Save(env.GetBaseDir())
+	}
+	return lock, RemoveNilErrors(errors)
+}
+
+// drainPending deploys the deployments pending on a node, assuming it is reachable. If apps is not empty, only
+// those of these applications are deployed. Pending deployments of applications which no longer exist are dropped.
+func (node *Node) drainPending(env Environment, lock RiotLock, apps []string, out io.Writer) ([]*deploymentResult, error) {
+	logger := newLogger(out)
+	results := make([]*deploymentResult, 0)
+	errors := make([]string, 0)
+	for _, pending := range lock.getPendingOf(node.Name, apps) {
+		app, err := env.GetApplication(pending.Application)
+		if err != nil {
+			logger.Printf("Dropping pending deployment of \"%s\" on \"%s\": %s\n", pending.Application, node.Name, err)
+			results = append(results, &deploymentResult{app: pending.Application, node: node.Name, dropped: true})
+			continue
+		}
+
+		logger.Printf("Deploying pending \"%s\" on \"%s\", queued at %s\n", app.Name, node.Name, pending.Queued)
+		result, err := app.deployImage(*node, env, lock, pending.Image, false, out)
+		if result != nil {
+			results = append(results, result)
+		}
+		if err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	if len(errors) > 0 {
+		return results, fmt.Errorf("error while deploying pending applications on %s: %s", node.Name, strings.Join(errors, "; "))
+	}
+	return results, nil
+}
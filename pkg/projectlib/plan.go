@@ -0,0 +1,179 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// PlanCreate marks an application which is not running on a node yet
+	PlanCreate = "create"
+	// PlanReplace marks an application whose container on a node would be replaced
+	PlanReplace = "replace"
+	// PlanRemove marks a container which runs an application the node is no longer a target of
+	PlanRemove = "remove"
+	// PlanUnchanged marks an application which already runs as configured
+	PlanUnchanged = "unchanged"
+)
+
+// PlanAction is a change a deployment would make on a node
+type PlanAction struct {
+	Application  string `json:"application"`
+	Node         string `json:"node"`
+	Action       string `json:"action"`
+	Container    string `json:"container,omitempty"`
+	CurrentImage string `json:"currentImage,omitempty"`
+	Image        string `json:"image,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// Plan compares what runs on a node with what the lock and the application configuration say should run there.
+// Containers of applications which are not in apps are only planned for removal if complete is true, i.e. if apps
+// are all applications of the project.
+func (node *Node) Plan(env Environment, lock RiotLock, apps []Application, complete bool) ([]PlanAction, error) {
+	if !node.IsAvailable() {
+		return nil, fmt.Errorf("node %s is not reachable", node.Name)
+	}
+
+	ctx, cancel := node.getContext()
+	defer cancel()
+	client, err := node.GetDockerClient(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+	containers, err := node.findContainers(ctx, client, env, "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]PlanAction, 0)
+	planned := make(map[string]bool)
+	for _, app := range apps {
+		planned[app.Name] = true
+
+		targets, err := app.SelectDeploymentTargets(env)
+		if err != nil {
+			return nil, err
+		}
+		isTarget := false
+		for _, target := range targets {
+			if target.Name == node.Name {
+				isTarget = true
+				break
+			}
+		}
+		if !isTarget {
+			continue
+		}
+
+		action, err := app.planDeployment(ctx, client, *node, env, lock, containers)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, action)
+	}
+
+	for _, c := range containers {
+		appName := c.Labels[LabelApplication]
+		if planned[appName] {
+			if hasPlannedDeployment(result, appName) {
+				continue
+			}
+		} else if !complete {
+			continue
+		}
+
+		result = append(result, PlanAction{
+			Application:  appName,
+			Node:         node.Name,
+			Action:       PlanRemove,
+			Container:    c.ID[:12],
+			CurrentImage: c.Labels[LabelVersion],
+		})
+	}
+	return result, nil
+}
+
+// planDeployment compares the container an application runs in on a node with the one a deployment would create.
+// A one-shot job which exited cleanly counts as running.
+func (app *Application) planDeployment(ctx context.Context, client *client.Client, node Node, env Environment, lock RiotLock, containers []types.Container) (PlanAction, error) {
+	imageName, ok := lock.Versions[app.Name]
+	if !ok {
+		return PlanAction{}, fmt.Errorf("application %s has no riot.lock entry. Please run riot build", app.Name)
+	}
+	config, hostConfig, err := app.getContainerConfig(node, env, lock, imageName)
+	if err != nil {
+		return PlanAction{}, err
+	}
+
+	action := PlanAction{
+		Application: app.Name,
+		Node:        node.Name,
+		Action:      PlanCreate,
+		Image:       imageName,
+	}
+	for _, c := range containers {
+		if c.Labels[LabelApplication] != app.Name || !hasContainerName(c, app.getContainerName()) {
+			continue
+		}
+
+		action.Container = c.ID[:12]
+		action.CurrentImage = c.Labels[LabelVersion]
+		completed := false
+		if isOneShot(hostConfig) && c.Labels[LabelFingerprint] == config.Labels[LabelFingerprint] {
+			completed, err = hasCompleted(ctx, client, c)
+			if err != nil {
+				return PlanAction{}, err
+			}
+		}
+
+		if completed {
+			action.Action = PlanUnchanged
+		} else if c.State != "running" {
+			action.Action = PlanReplace
+			action.Reason = "container is " + c.State
+		} else if action.CurrentImage != imageName {
+			action.Action = PlanReplace
+			action.Reason = "new image"
+		} else if c.Labels[LabelFingerprint] != config.Labels[LabelFingerprint] {
+			action.Action = PlanReplace
+			action.Reason = "run configuration changed"
+		} else {
+			action.Action = PlanUnchanged
+		}
+		break
+	}
+	return action, nil
+}
+
+func hasPlannedDeployment(actions []PlanAction, app string) bool {
+	for _, action := range actions {
+		if action.Application == app && action.Action != PlanRemove {
+			return true
+		}
+	}
+	return false
+}
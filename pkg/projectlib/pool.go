@@ -0,0 +1,89 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+)
+
+// Task is a unit of work run by RunParallel. Everything it wants to print goes to out.
+type Task func(out io.Writer) error
+
+// RunParallel runs tasks, at most parallel of them at the same time, and returns their errors in task order.
+// When tasks run concurrently their output is buffered and written to out in task order, one task at a time,
+// so that the output of different nodes does not interleave.
+func RunParallel(parallel int, out io.Writer, tasks []Task) []error {
+	errs := make([]error, len(tasks))
+	if parallel <= 1 {
+		for idx, task := range tasks {
+			errs[idx] = task(out)
+		}
+		return errs
+	}
+
+	buffers := make([]bytes.Buffer, len(tasks))
+	done := make([]chan struct{}, len(tasks))
+	slots := make(chan struct{}, parallel)
+	for idx, task := range tasks {
+		done[idx] = make(chan struct{})
+		go func(idx int, task Task) {
+			defer close(done[idx])
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			errs[idx] = task(&buffers[idx])
+		}(idx, task)
+	}
+
+	for idx := range tasks {
+		<-done[idx]
+		out.Write(buffers[idx].Bytes())
+	}
+	return errs
+}
+
+// RemoveNilErrors returns the errors of a list, e.g. the one returned by RunParallel, which are not nil
+func RemoveNilErrors(errors []error) []error {
+	result := make([]error, 0)
+	for _, err := range errors {
+		if err != nil {
+			result = append(result, err)
+		}
+	}
+	return result
+}
+
+// newLogger creates a logger which writes to out the way the standard logger does
+func newLogger(out io.Writer) *log.Logger {
+	return log.New(out, "", log.LstdFlags)
+}
+
+// getContext returns a context for API calls which check on a node. It ends once the node's timeout has passed,
+// so it must not be used for long running transfers like image pulls.
+func (node *Node) getContext() (context.Context, context.CancelFunc) {
+	if node.Timeout > 0 {
+		return context.WithTimeout(context.Background(), node.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
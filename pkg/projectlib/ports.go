@@ -0,0 +1,66 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/docker/go-connections/nat"
+)
+
+// parsePortMapping parses a single entry of the ports configuration of an application.
+// The host side has the form [ip:]port[-port], the container side port[-port][/protocol].
+func parsePortMapping(hostPort string, containerPort string) ([]nat.PortMapping, error) {
+	mappings, err := nat.ParsePortSpec(hostPort + ":" + containerPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port mapping %s: %s: %s", hostPort, containerPort, err)
+	}
+	return mappings, nil
+}
+
+// getPortBindings computes the exposed ports and their host bindings from the port configuration
+func (run *AppRun) getPortBindings() (nat.PortSet, nat.PortMap, error) {
+	exposedPorts := make(nat.PortSet)
+	portBindings := make(nat.PortMap)
+	for hostPort, containerPort := range run.Ports {
+		mappings, err := parsePortMapping(hostPort, containerPort)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, mapping := range mappings {
+			exposedPorts[mapping.Port] = struct{}{}
+			portBindings[mapping.Port] = append(portBindings[mapping.Port], mapping.Binding)
+		}
+	}
+
+	// the ports come from a map, so without sorting the order would change from run to run and with it the fingerprint
+	for _, bindings := range portBindings {
+		sort.Slice(bindings, func(i, j int) bool {
+			if bindings[i].HostIP != bindings[j].HostIP {
+				return bindings[i].HostIP < bindings[j].HostIP
+			}
+			return bindings[i].HostPort < bindings[j].HostPort
+		})
+	}
+	return exposedPorts, portBindings, nil
+}
@@ -0,0 +1,182 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// PruneAction is a single resource which prune removes from a node
+type PruneAction struct {
+	Kind string
+	ID   string
+	Name string
+}
+
+func (action PruneAction) String() string {
+	return fmt.Sprintf("%s %s (%s)", action.Kind, action.Name, action.ID)
+}
+
+// Prune removes stopped riot containers, unused riot networks and unused riot images from a node. The last keep builds
+// of each application in the history are kept so that they remain available to riot rollback, and are returned as
+// well. If dryRun is true nothing is removed and the actions which would have been taken are returned.
+func (node *Node) Prune(env Environment, lock RiotLock, history BuildHistory, keep int, dryRun bool) ([]PruneAction, []PruneAction, error) {
+	ctx, cancel := node.getContext()
+	defer cancel()
+	client, err := node.GetDockerClient(ctx, env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := make([]PruneAction, 0)
+	containers, err := node.findContainers(ctx, client, env, "", true)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, c := range containers {
+		if c.State != "exited" && c.State != "created" && c.State != "dead" {
+			continue
+		}
+
+		action := PruneAction{Kind: "container", ID: c.ID[:12], Name: strings.TrimPrefix(c.Names[0], "/")}
+		if !dryRun {
+			err := client.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{})
+			if err != nil {
+				return result, nil, err
+			}
+		}
+		result = append(result, action)
+	}
+
+	networks, err := node.removeUnusedNetworks(ctx, client, env, dryRun)
+	if err != nil {
+		return result, nil, err
+	}
+	for _, n := range networks {
+		result = append(result, PruneAction{Kind: "network", ID: n.ID[:12], Name: n.Name})
+	}
+
+	images, kept, err := findUnusedImages(ctx, client, env, lock, history, keep)
+	if err != nil {
+		return result, nil, err
+	}
+	keptActions := make([]PruneAction, len(kept))
+	for idx, img := range kept {
+		keptActions[idx] = newImageAction(img)
+	}
+	for _, img := range images {
+		action := newImageAction(img)
+		if !dryRun {
+			_, err := client.ImageRemove(ctx, img.ID, types.ImageRemoveOptions{Force: true, PruneChildren: true})
+			if err != nil {
+				return result, nil, err
+			}
+		}
+		result = append(result, action)
+	}
+
+	return result, keptActions, nil
+}
+
+func newImageAction(img types.ImageSummary) PruneAction {
+	name := "<none>"
+	if len(img.RepoTags) > 0 {
+		name = img.RepoTags[0]
+	}
+	return PruneAction{Kind: "image", ID: strings.TrimPrefix(img.ID, "sha256:")[:12], Name: name}
+}
+
+// findUnusedImages lists all images built by riot for this project which are neither the current version
+// in the lock nor used by any container. Images built before riot labeled its images are
+// recognized by their repository. Unused images among the last keep builds of an application in the history
+// are listed separately.
+func findUnusedImages(ctx context.Context, client *client.Client, env Environment, lock RiotLock, history BuildHistory, keep int) ([]types.ImageSummary, []types.ImageSummary, error) {
+	apps, err := env.GetApplications()
+	if err != nil {
+		return nil, nil, err
+	}
+	repositories := make([]string, len(apps))
+	recent := make(map[string]bool)
+	for idx, app := range apps {
+		repositories[idx] = app.getImageRepository(env) + ":"
+		for _, imageName := range history.Recent(app.Name, keep) {
+			recent[imageName] = true
+		}
+	}
+
+	current := make(map[string]bool)
+	for _, imageName := range lock.Versions {
+		current[imageName] = true
+	}
+
+	containers, err := client.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	used := make(map[string]bool)
+	for _, c := range containers {
+		used[c.ImageID] = true
+	}
+
+	images, err := client.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := make([]types.ImageSummary, 0)
+	kept := make([]types.ImageSummary, 0)
+	for _, img := range images {
+		if used[img.ID] {
+			continue
+		}
+
+		isRiotImage := img.Labels[LabelProject] == env.GetName()
+		isCurrent := false
+		isRecent := false
+		for _, tag := range img.RepoTags {
+			if current[tag] {
+				isCurrent = true
+			}
+			if recent[tag] {
+				isRecent = true
+			}
+			for _, repo := range repositories {
+				if strings.HasPrefix(tag, repo) {
+					isRiotImage = true
+				}
+			}
+		}
+
+		if !isRiotImage || isCurrent {
+			continue
+		} else if isRecent {
+			kept = append(kept, img)
+		} else {
+			result = append(result, img)
+		}
+	}
+	return result, kept, nil
+}
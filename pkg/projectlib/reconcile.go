@@ -0,0 +1,320 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReconcileInterval = time.Minute
+	defaultMaxBackoff        = 15 * time.Minute
+	projectPollInterval      = 2 * time.Second
+)
+
+// Reconciler converges the nodes of a project towards what its applications, environment and riot.lock describe
+type Reconciler struct {
+	Basedir string
+	// Interval is the time between two reconciliations, defaults to a minute
+	Interval time.Duration
+	// Parallel is the number of nodes reconciled at the same time
+	Parallel int
+	// Prune removes containers of applications from nodes they are no longer deployed to
+	Prune bool
+	// MaxBackoff is the longest time an offline node is left alone, defaults to 15 minutes
+	MaxBackoff time.Duration
+
+	backoff map[string]nodeBackoff
+}
+
+// nodeBackoff tracks a node which was offline, or could not be reconciled, during previous reconciliations
+type nodeBackoff struct {
+	failures int
+	until    time.Time
+	offline  bool
+}
+
+// Run reconciles the project every interval, and as soon as a file of the project changes, until stop is closed
+func (r *Reconciler) Run(stop <-chan struct{}) {
+	interval := r.getInterval()
+	poll := time.NewTicker(projectPollInterval)
+	defer poll.Stop()
+
+	var signature string
+	var lastRun time.Time
+	for {
+		current := getProjectSignature(r.Basedir)
+		if current != signature || time.Since(lastRun) >= interval {
+			if signature != "" && current != signature {
+				log.Println("Project changed, reconciling")
+			}
+
+			for _, err := range r.Reconcile() {
+				log.Println(err)
+			}
+			lastRun = time.Now()
+			// don't mistake the lock we just saved for a change
+			signature = getProjectSignature(r.Basedir)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-poll.C:
+		}
+	}
+}
+
+// Reconcile loads the project and converges each of its nodes once, starting with the deployments pending on them.
+// Nodes which were offline or failed to reconcile before are skipped until their backoff has passed.
+func (r *Reconciler) Reconcile() []error {
+	env, err := LoadEnv(r.Basedir)
+	if err != nil {
+		return []error{fmt.Errorf("error while loading environment from %s: %s", r.Basedir, err)}
+	}
+	apps, err := env.GetApplications()
+	if err != nil {
+		return []error{fmt.Errorf("error while loading application descriptions: %s", err)}
+	}
+	lock, err := LoadLock(r.Basedir)
+	if os.IsNotExist(err) {
+		// nothing was built yet, so there is nothing to deploy
+		return nil
+	} else if err != nil {
+		return []error{err}
+	}
+	if r.backoff == nil {
+		r.backoff = make(map[string]nodeBackoff)
+	}
+
+	nodes := env.GetNodes()
+	results := make([][]*deploymentResult, len(nodes))
+	removed := make([][]string, len(nodes))
+	offline := make([]bool, len(nodes))
+	tasks := make([]Task, len(nodes))
+	for idx, node := range nodes {
+		idx, node := idx, node
+		tasks[idx] = func(out io.Writer) error {
+			if time.Now().Before(r.backoff[node.Name].until) {
+				return nil
+			}
+			if !node.IsAvailable() {
+				offline[idx] = true
+				return nil
+			}
+
+			pending, pendingErr := node.drainPending(env, lock, nil, out)
+			reconciled, reconciledRemoved, err := node.reconcile(env, lock, apps, r.Prune, out)
+			results[idx] = append(pending, reconciled...)
+			removed[idx] = reconciledRemoved
+			if err == nil {
+				err = pendingErr
+			}
+			return err
+		}
+	}
+	errors := RunParallel(r.Parallel, os.Stderr, tasks)
+
+	changed := false
+	for idx, node := range nodes {
+		if offline[idx] {
+			log.Printf("Node %s is offline, retrying in %s\n", node.Name, r.backOff(node.Name, true))
+			continue
+		} else if errors[idx] != nil {
+			log.Printf("Reconciling node %s failed, retrying in %s\n", node.Name, r.backOff(node.Name, false))
+		} else if state, ok := r.backoff[node.Name]; ok && !time.Now().Before(state.until) {
+			if state.offline {
+				log.Printf("Node %s is back online\n", node.Name)
+			}
+			delete(r.backoff, node.Name)
+		}
+
+		for _, result := range results[idx] {
+			result.apply(&lock)
+			changed = true
+		}
+		for _, app := range removed[idx] {
+			lock.RemoveDeployment(app, node.Name)
+			lock.ClearPending(node.Name, app)
+			changed = true
+		}
+	}
+	if changed {
+		if err := lock.Save(env.GetBaseDir()); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	return RemoveNilErrors(errors)
+}
+
+func (r *Reconciler) getInterval() time.Duration {
+	if r.Interval <= 0 {
+		return defaultReconcileInterval
+	}
+	return r.Interval
+}
+
+// backOff doubles the time a node which is offline or failing is left alone, starting at the interval up to the
+// maximum backoff, and returns that time
+func (r *Reconciler) backOff(node string, offline bool) time.Duration {
+	maxBackoff := r.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	state := r.backoff[node]
+	state.failures++
+	state.offline = offline
+	wait := r.getInterval()
+	for i := 1; i < state.failures && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	state.until = time.Now().Add(wait)
+	r.backoff[node] = state
+	return wait
+}
+
+// reconcile deploys the applications which do not run on a node as configured and, if prune is true, removes the
+// containers of applications which are no longer deployed to the node. Applications which were never built, nodes
+// which are not part of an application's canary, images whose rollout was aborted and images which already failed
+// on the node are left alone.
+func (node *Node) reconcile(env Environment, lock RiotLock, apps []Application, prune bool, out io.Writer) ([]*deploymentResult, []string, error) {
+	built := make([]Application, 0)
+	for _, app := range apps {
+		if _, ok := lock.Versions[app.Name]; ok {
+			built = append(built, app)
+		}
+	}
+	plan, err := node.Plan(env, lock, built, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger := newLogger(out)
+	results := make([]*deploymentResult, 0)
+	removed := make([]string, 0)
+	errors := make([]string, 0)
+	for _, action := range plan {
+		if action.Action == PlanUnchanged {
+			continue
+		}
+		if action.Action == PlanRemove {
+			if _, isBuilt := lock.Versions[action.Application]; !prune || (!isBuilt && isApplication(apps, action.Application)) {
+				continue
+			}
+
+			logger.Printf("Removing \"%s\" from \"%s\"\n", action.Application, node.Name)
+			if _, err := node.Undeploy(env, action.Application); err != nil {
+				errors = append(errors, err.Error())
+				continue
+			}
+			removed = append(removed, action.Application)
+			continue
+		}
+		if canary, ok := lock.GetCanary(action.Application); ok && !containsString(canary.Nodes, node.Name) {
+			continue
+		}
+		if aborted, ok := lock.GetAbortedRollout(action.Application); ok && aborted.Image == action.Image {
+			// the rollout stopped because the image failed on too many nodes, it must not reach the rest this way
+			continue
+		}
+		if outcome, ok := lock.GetOutcome(action.Application, node.Name); ok && outcome.Image == action.Image &&
+			(outcome.Status == OutcomeRolledBack || outcome.Status == OutcomeFailed) {
+			// trying the same image again would only replace a working container with a broken one again
+			continue
+		}
+
+		for _, app := range built {
+			if app.Name != action.Application {
+				continue
+			}
+
+			logger.Printf("Reconciling \"%s\" on \"%s\": %s\n", app.Name, node.Name, describePlanAction(action))
+			result, err := app.deployImage(*node, env, lock, action.Image, false, out)
+			if result != nil {
+				results = append(results, result)
+			}
+			if err != nil {
+				errors = append(errors, err.Error())
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		return results, removed, fmt.Errorf("error while reconciling %s: %s", node.Name, strings.Join(errors, "; "))
+	}
+	return results, removed, nil
+}
+
+func describePlanAction(action PlanAction) string {
+	if action.Reason == "" {
+		return action.Action
+	}
+	return action.Action + ", " + action.Reason
+}
+
+func isApplication(apps []Application, name string) bool {
+	for _, app := range apps {
+		if app.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getProjectSignature summarizes the files of a project, so that changes can be detected by comparing signatures
+func getProjectSignature(basedir string) string {
+	count := 0
+	var latest time.Time
+	filepath.Walk(basedir, func(fn string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && fn != basedir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		count++
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return fmt.Sprintf("%d-%d", count, latest.UnixNano())
+}
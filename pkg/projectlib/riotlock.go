@@ -21,6 +21,8 @@
 package projectlib
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"io/ioutil"
 	"os"
 	"path"
@@ -30,8 +32,29 @@ import (
 
 // RiotLock locks an application to a specific image version
 type RiotLock struct {
-	Versions   map[string]string            `yaml:"versions"`
-	Deployment map[string]map[string]string `yaml:"deployment"`
+	Versions   map[string]string                       `yaml:"versions"`
+	Deployment map[string]map[string]string            `yaml:"deployment"`
+	Outcomes   map[string]map[string]DeploymentOutcome `yaml:"outcomes,omitempty"`
+	Canaries   map[string]CanaryState                  `yaml:"canaries,omitempty"`
+	Pending    map[string][]PendingDeployment          `yaml:"pending,omitempty"`
+	Aborted    map[string]AbortedRollout               `yaml:"aborted,omitempty"`
+}
+
+const (
+	// OutcomeDeployed marks a deployment whose container came up successfully
+	OutcomeDeployed = "deployed"
+	// OutcomeRolledBack marks a deployment which failed and was replaced by the previous container
+	OutcomeRolledBack = "rolled-back"
+	// OutcomeFailed marks a deployment which failed and could not be rolled back
+	OutcomeFailed = "failed"
+)
+
+// DeploymentOutcome records the result of the last deployment of an application on a node
+type DeploymentOutcome struct {
+	Image  string `yaml:"image"`
+	Status string `yaml:"status"`
+	Time   string `yaml:"time"`
+	Error  string `yaml:"error,omitempty"`
 }
 
 // Save stores a riot lock in a project
@@ -41,8 +64,7 @@ func (lock RiotLock) Save(basedir string) error {
 		return err
 	}
 
-	err = ioutil.WriteFile(path.Join(basedir, "riot.lock"), data, os.ModePerm)
-	return err
+	return writeFileAtomic(path.Join(basedir, "riot.lock"), data, 0644)
 }
 
 // LoadLock loads a riot.lock file for a project
@@ -67,7 +89,30 @@ func LoadLock(basedir string) (RiotLock, error) {
 	return result, nil
 }
 
+// Hash computes a short fingerprint of the image versions in this lock
+func (lock RiotLock) Hash() string {
+	data, err := yaml.Marshal(lock.Versions)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// SetVersion locks an application to a newly built image
+func (lock *RiotLock) SetVersion(app string, imageName string) {
+	if lock.Versions == nil {
+		lock.Versions = make(map[string]string)
+	}
+	lock.Versions[app] = imageName
+}
+
+// AddDeployment records the container an application runs in on a node
 func (lock *RiotLock) AddDeployment(app string, node string, version string) {
+	if lock.Deployment == nil {
+		lock.Deployment = make(map[string]map[string]string)
+	}
 	deps, ok := lock.Deployment[app]
 	if !ok {
 		deps = make(map[string]string)
@@ -76,6 +121,7 @@ func (lock *RiotLock) AddDeployment(app string, node string, version string) {
 	lock.Deployment[app] = deps
 }
 
+// GetDeployment returns the container an application was last deployed to on a node
 func (lock *RiotLock) GetDeployment(app string, node string) (string, bool) {
 	deps, ok := lock.Deployment[app]
 	if !ok {
@@ -85,3 +131,27 @@ func (lock *RiotLock) GetDeployment(app string, node string) (string, bool) {
 	dep, ok := deps[node]
 	return dep, ok
 }
+
+// SetOutcome records the result of deploying an application on a node
+func (lock *RiotLock) SetOutcome(app string, node string, outcome DeploymentOutcome) {
+	if lock.Outcomes == nil {
+		lock.Outcomes = make(map[string]map[string]DeploymentOutcome)
+	}
+	outcomes, ok := lock.Outcomes[app]
+	if !ok {
+		outcomes = make(map[string]DeploymentOutcome)
+	}
+	outcomes[node] = outcome
+	lock.Outcomes[app] = outcomes
+}
+
+// GetOutcome returns the result of the last deployment of an application on a node
+func (lock *RiotLock) GetOutcome(app string, node string) (DeploymentOutcome, bool) {
+	outcomes, ok := lock.Outcomes[app]
+	if !ok {
+		return DeploymentOutcome{}, false
+	}
+
+	outcome, ok := outcomes[node]
+	return outcome, ok
+}
@@ -0,0 +1,222 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// AppRollout controls how a new version of an application is rolled out across its nodes
+type AppRollout struct {
+	// MaxParallel is the number of nodes of a batch which are deployed at the same time, defaults to one
+	MaxParallel int `yaml:"maxParallel,omitempty"`
+	// BatchSize is the number of nodes deployed before the failure threshold is checked, defaults to MaxParallel
+	BatchSize int `yaml:"batchSize,omitempty"`
+	// Pause is the time to wait between two batches
+	Pause time.Duration `yaml:"pause,omitempty"`
+	// MaxFailures is the number of failed nodes tolerated before the rollout is aborted. -1 never aborts.
+	MaxFailures int `yaml:"maxFailures,omitempty"`
+	// Rollback redeploys the previous image to all updated nodes when the rollout is aborted
+	Rollback bool `yaml:"rollback,omitempty"`
+}
+
+// AbortedRollout records an image whose rollout was aborted, so that it is not deployed to the nodes it did not reach
+type AbortedRollout struct {
+	Image   string `yaml:"image"`
+	Aborted string `yaml:"aborted"`
+}
+
+func (rollout *AppRollout) validate() error {
+	if rollout.MaxParallel < 0 || rollout.BatchSize < 0 || rollout.Pause < 0 {
+		return fmt.Errorf("maxParallel, batchSize and pause must not be negative")
+	}
+	if rollout.MaxFailures < -1 {
+		return fmt.Errorf("maxFailures must be -1 or more")
+	}
+	return nil
+}
+
+// Rollout deploys the locked version of an application to the given nodes in batches. Once more than
+// maxFailures nodes have failed, the rollout stops and, if configured, the nodes updated so far are rolled back
+// to the image they ran before. An aborted rollout is recorded in the lock until a rollout of the application
+// completes. The lock is saved after every batch. Unless force is true, nodes which are already up to date are
+// skipped. Unreachable nodes do not count as failed, their deployment is queued in the lock instead.
+func (app *Application) Rollout(nodes []Node, env Environment, lock RiotLock, force bool) (RiotLock, []error) {
+	errors := make([]error, 0)
+	imageName, ok := lock.Versions[app.Name]
+	if !ok {
+		return lock, append(errors, fmt.Errorf("application %s has no riot.lock entry. Please run riot build", app.Name))
+	}
+
+	cfg := app.RolloutCfg
+	if err := cfg.validate(); err != nil {
+		return lock, append(errors, fmt.Errorf("invalid rollout of application %s: %s", app.Name, err))
+	}
+	batchSize := cfg.BatchSize
+	if batchSize == 0 {
+		batchSize = cfg.MaxParallel
+	}
+	if batchSize == 0 {
+		batchSize = 1
+	}
+
+	updated := make([]*deploymentResult, 0)
+	queued := make([]string, 0)
+	aborted := false
+	for start := 0; start < len(nodes); start += batchSize {
+		if start > 0 && cfg.Pause > 0 {
+			log.Printf("Waiting %s before deploying the next batch of \"%s\"\n", cfg.Pause, app.Name)
+			time.Sleep(cfg.Pause)
+		}
+
+		end := start + batchSize
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+		batch := nodes[start:end]
+		results, errs := app.deployBatch(batch, env, lock, imageName, force, cfg.MaxParallel)
+		for idx := range batch {
+			if results[idx] != nil {
+				results[idx].apply(&lock)
+			}
+			if errs[idx] != nil {
+				errors = append(errors, errs[idx])
+			} else if results[idx].queued {
+				queued = append(queued, results[idx].node)
+			} else if !results[idx].skipped {
+				updated = append(updated, results[idx])
+			}
+		}
+		lock.Save(env.GetBaseDir())
+
+		if cfg.MaxFailures >= 0 && len(errors) > cfg.MaxFailures {
+			aborted = true
+			if end < len(nodes) {
+				errors = append(errors, fmt.Errorf("rollout of %s aborted after %d failed nodes, %d nodes were not updated", app.Name, len(errors), len(nodes)-end))
+			}
+			break
+		}
+	}
+
+	if !aborted {
+		lock.ClearAbortedRollout(app.Name)
+		lock.Save(env.GetBaseDir())
+		return lock, errors
+	}
+
+	// an aborted rollout must neither continue once the unreachable nodes are back nor by reconciliation
+	for _, node := range queued {
+		lock.ClearPending(node, app.Name)
+	}
+	lock.AbortRollout(app.Name, imageName)
+	if cfg.Rollback {
+		for _, result := range updated {
+			lock, errors = app.rollbackNode(result, env, lock, errors)
+		}
+	}
+	lock.Save(env.GetBaseDir())
+	return lock, errors
+}
+
+// AbortRollout records that the rollout of an image of an application was aborted
+func (lock *RiotLock) AbortRollout(app string, imageName string) {
+	if lock.Aborted == nil {
+		lock.Aborted = make(map[string]AbortedRollout)
+	}
+	lock.Aborted[app] = AbortedRollout{
+		Image:   imageName,
+		Aborted: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// GetAbortedRollout returns the aborted rollout of an application, if there is one
+func (lock *RiotLock) GetAbortedRollout(app string) (AbortedRollout, bool) {
+	aborted, ok := lock.Aborted[app]
+	return aborted, ok
+}
+
+// ClearAbortedRollout forgets the aborted rollout of an application
+func (lock *RiotLock) ClearAbortedRollout(app string) {
+	delete(lock.Aborted, app)
+}
+
+// deployBatch deploys an image to a set of nodes, at most maxParallel at a time
+func (app *Application) deployBatch(nodes []Node, env Environment, lock RiotLock, imageName string, force bool, maxParallel int) ([]*deploymentResult, []error) {
+	results := make([]*deploymentResult, len(nodes))
+	tasks := make([]Task, len(nodes))
+	for idx, node := range nodes {
+		idx, node := idx, node
+		tasks[idx] = func(out io.Writer) error {
+			logger := newLogger(out)
+			if !node.IsAvailable() {
+				logger.Printf("\"%s\" is unreachable, deploying \"%s\" once it is back\n", node.Name, app.Name)
+				results[idx] = &deploymentResult{
+					app:     app.Name,
+					node:    node.Name,
+					queued:  true,
+					outcome: DeploymentOutcome{Image: imageName},
+				}
+				return nil
+			}
+
+			logger.Printf("Deploying \"%s\" on \"%s\"\n", app.Name, node.Name)
+
+			var err error
+			results[idx], err = app.deployImage(node, env, lock, imageName, force, out)
+			return err
+		}
+	}
+	return results, RunParallel(maxParallel, os.Stderr, tasks)
+}
+
+// rollbackNode redeploys the image an application ran before a successful deployment
+func (app *Application) rollbackNode(result *deploymentResult, env Environment, lock RiotLock, errors []error) (RiotLock, []error) {
+	if result.previousImage == "" {
+		log.Printf("Not rolling back \"%s\" on \"%s\": it was not running before\n", app.Name, result.node)
+		return lock, errors
+	}
+
+	nodes, err := env.SelectNodes("#" + result.node)
+	if err != nil || len(nodes) == 0 {
+		return lock, append(errors, fmt.Errorf("cannot roll back %s on %s: node not found", app.Name, result.node))
+	}
+
+	log.Printf("Rolling back \"%s\" on \"%s\" to %s\n", app.Name, result.node, result.previousImage)
+	rollback, err := app.deployImage(nodes[0], env, lock, result.previousImage, false, os.Stderr)
+	if rollback != nil {
+		rollback.apply(&lock)
+	}
+	if err != nil {
+		return lock, append(errors, err)
+	}
+
+	lock.SetOutcome(app.Name, result.node, DeploymentOutcome{
+		Image:  result.outcome.Image,
+		Status: OutcomeRolledBack,
+		Time:   time.Now().UTC().Format(time.RFC3339),
+		Error:  "rollout aborted",
+	})
+	return lock, errors
+}
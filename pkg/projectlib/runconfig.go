@@ -0,0 +1,229 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+const defaultStartTimeout = 30 * time.Second
+
+// getContainerName returns the name of the container an application runs in
+func (app *Application) getContainerName() string {
+	return "riot-" + app.Name
+}
+
+// getContainerConfig computes the docker configuration of the container which runs an application on a node
+func (app *Application) getContainerConfig(node Node, env Environment, lock RiotLock, imageName string) (*container.Config, *container.HostConfig, error) {
+	rendered, err := app.Render(node)
+	if err != nil {
+		return nil, nil, err
+	}
+	run := rendered.RunCfg
+
+	exposedPorts, portBindings, err := run.getPortBindings()
+	if err != nil {
+		return nil, nil, err
+	}
+	restartPolicy, err := parseRestartPolicy(run.Restart)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resources, err := run.Limits.getResources()
+	if err != nil {
+		return nil, nil, err
+	}
+	resources.Devices, err = run.getDevices()
+	if err != nil {
+		return nil, nil, err
+	}
+	resources.DeviceCgroupRules = run.DeviceCgroupRules
+
+	networkMode, err := run.getNetworkMode()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostConfig := container.HostConfig{
+		NetworkMode:   networkMode,
+		Privileged:    run.Priviliged,
+		PortBindings:  portBindings,
+		RestartPolicy: restartPolicy,
+		CapAdd:        run.CapAdd,
+		CapDrop:       run.CapDrop,
+		GroupAdd:      run.GroupAdd,
+		Resources:     resources,
+	}
+	if len(run.Volumes) > 0 {
+		hostConfig.Mounts, err = run.getMounts()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	environment, err := rendered.getEnvironment(node, env)
+	if err != nil {
+		return nil, nil, err
+	}
+	healthcheck, err := run.Healthcheck.getHealthConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := container.Config{
+		Image:        imageName,
+		Cmd:          run.Command,
+		Entrypoint:   run.Entrypoint,
+		User:         run.User,
+		WorkingDir:   run.Workdir,
+		Hostname:     run.Hostname,
+		Tty:          run.Tty,
+		OpenStdin:    run.Stdin,
+		Env:          environment,
+		ExposedPorts: exposedPorts,
+		Healthcheck:  healthcheck,
+	}
+	fingerprint, err := getFingerprint(&config, &hostConfig, run.Networks)
+	if err != nil {
+		return nil, nil, err
+	}
+	config.Labels = app.getContainerLabels(node, env, lock, imageName, fingerprint)
+
+	return &config, &hostConfig, nil
+}
+
+// getFingerprint hashes the configuration of a container, except for its labels which change with every deployment
+func getFingerprint(config *container.Config, hostConfig *container.HostConfig, networks []string) (string, error) {
+	data, err := json.Marshal([]interface{}{config, hostConfig, networks})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12], nil
+}
+
+// getStartTimeout returns the time we wait for a new container to come up, or become healthy, before rolling back.
+// Unless set explicitly, waiting for the healthcheck takes as long as docker may need to decide on the health.
+func (run *AppRun) getStartTimeout() time.Duration {
+	if run.StartTimeout > 0 {
+		return run.StartTimeout
+	}
+	if run.Healthcheck.Wait && run.Healthcheck.getDecisionTime() > defaultStartTimeout {
+		return run.Healthcheck.getDecisionTime()
+	}
+	return defaultStartTimeout
+}
+
+// getDevices parses the devices an application has access to
+func (run *AppRun) getDevices() ([]container.DeviceMapping, error) {
+	result := make([]container.DeviceMapping, len(run.Devices))
+	for idx, spec := range run.Devices {
+		device, err := parseDevice(spec)
+		if err != nil {
+			return nil, err
+		}
+		result[idx] = device
+	}
+	return result, nil
+}
+
+// parseDevice parses a device of the form host-path[:container-path][:permissions] where permissions is
+// a combination of r (read), w (write) and m (mknod), defaulting to rwm
+func parseDevice(spec string) (container.DeviceMapping, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) == 2 && isDevicePermissions(parts[1]) {
+		parts = []string{parts[0], parts[0], parts[1]}
+	}
+	if len(parts) == 1 {
+		parts = append(parts, parts[0])
+	}
+	if len(parts) == 2 {
+		parts = append(parts, "rwm")
+	}
+
+	if len(parts) != 3 {
+		return container.DeviceMapping{}, fmt.Errorf("invalid device %s: must be host-path[:container-path][:permissions]", spec)
+	}
+	if !strings.HasPrefix(parts[0], "/") || !strings.HasPrefix(parts[1], "/") {
+		return container.DeviceMapping{}, fmt.Errorf("invalid device %s: paths must be absolute", spec)
+	}
+	if !isDevicePermissions(parts[2]) {
+		return container.DeviceMapping{}, fmt.Errorf("invalid device %s: permissions must be a combination of r, w and m", spec)
+	}
+
+	return container.DeviceMapping{
+		PathOnHost:        parts[0],
+		PathInContainer:   parts[1],
+		CgroupPermissions: parts[2],
+	}, nil
+}
+
+func isDevicePermissions(permissions string) bool {
+	if permissions == "" || len(permissions) > 3 {
+		return false
+	}
+	for _, c := range permissions {
+		if !strings.ContainsRune("rwm", c) || strings.Count(permissions, string(c)) > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRestartPolicy parses a restart policy of the form no, always, unless-stopped or on-failure[:N]
+func parseRestartPolicy(policy string) (container.RestartPolicy, error) {
+	name := policy
+	retries := ""
+	if idx := strings.Index(policy, ":"); idx >= 0 {
+		name = policy[:idx]
+		retries = policy[idx+1:]
+	}
+
+	switch name {
+	case "", "no", "always", "unless-stopped":
+		if retries != "" {
+			return container.RestartPolicy{}, fmt.Errorf("invalid restart policy %s: %s does not support a retry count", policy, name)
+		}
+		return container.RestartPolicy{Name: name}, nil
+	case "on-failure":
+		result := container.RestartPolicy{Name: name}
+		if retries != "" {
+			count, err := strconv.Atoi(retries)
+			if err != nil || count < 0 {
+				return container.RestartPolicy{}, fmt.Errorf("invalid restart policy %s: retry count must be a non-negative number", policy)
+			}
+			result.MaximumRetryCount = count
+		}
+		return result, nil
+	default:
+		return container.RestartPolicy{}, fmt.Errorf("invalid restart policy %s: must be one of no, always, unless-stopped or on-failure[:N]", policy)
+	}
+}
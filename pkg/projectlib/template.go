@@ -0,0 +1,148 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// templateContext is what templates in application.yaml are rendered against
+type templateContext struct {
+	App  string
+	Node Node
+	Vars map[string]string
+}
+
+// Render returns a copy of the application with its run configuration rendered for a node.
+// Env, volumes, ports, command and hostname may contain templates referencing .App, .Node (e.g. .Node.Name, .Node.Host, .Node.Labels)
+// and .Vars, the vars declared for the node in environment.yaml.
+func (app *Application) Render(node Node) (*Application, error) {
+	ctx := templateContext{
+		App:  app.Name,
+		Node: node,
+		Vars: node.Vars,
+	}
+
+	result := *app
+	var err error
+	result.RunCfg.Env, err = renderMap("env", app.RunCfg.Env, ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if app.RunCfg.NodeEnv != nil {
+		result.RunCfg.NodeEnv = make(map[string]map[string]string)
+		for nodeName, vars := range app.RunCfg.NodeEnv {
+			result.RunCfg.NodeEnv[nodeName], err = renderMap("nodeEnv", vars, ctx, false)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if app.RunCfg.Volumes != nil {
+		result.RunCfg.Volumes = make(AppVolumes, len(app.RunCfg.Volumes))
+		for idx, volume := range app.RunCfg.Volumes {
+			volume.Source, err = renderTemplate("volumes", volume.Source, ctx)
+			if err != nil {
+				return nil, err
+			}
+			volume.Target, err = renderTemplate("volumes", volume.Target, ctx)
+			if err != nil {
+				return nil, err
+			}
+			result.RunCfg.Volumes[idx] = volume
+		}
+	}
+	result.RunCfg.Ports, err = renderMap("ports", app.RunCfg.Ports, ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	result.RunCfg.Command, err = renderList("command", app.RunCfg.Command, ctx)
+	if err != nil {
+		return nil, err
+	}
+	result.RunCfg.Hostname, err = renderTemplate("hostname", app.RunCfg.Hostname, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// renderMap renders all values, and keys if renderKeys is true, of a map
+func renderMap(field string, values map[string]string, ctx templateContext, renderKeys bool) (map[string]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	result := make(map[string]string)
+	for key, value := range values {
+		renderedValue, err := renderTemplate(field+"."+key, value, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if renderKeys {
+			key, err = renderTemplate(field, key, ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result[key] = renderedValue
+	}
+	return result, nil
+}
+
+// renderList renders all elements of a list
+func renderList(field string, values []string, ctx templateContext) ([]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	result := make([]string, len(values))
+	for idx, value := range values {
+		rendered, err := renderTemplate(field, value, ctx)
+		if err != nil {
+			return nil, err
+		}
+		result[idx] = rendered
+	}
+	return result, nil
+}
+
+func renderTemplate(name string, text string, ctx templateContext) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template in %s of application %s: %s", name, ctx.App, err)
+	}
+
+	var result bytes.Buffer
+	err = tpl.Execute(&result, ctx)
+	if err != nil {
+		return "", fmt.Errorf("cannot render %s of application %s for node %s: %s", name, ctx.App, ctx.Node.Name, err)
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,115 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// TransferRegistry distributes images by pushing them to the registry and pulling them on each node
+	TransferRegistry = "registry"
+	// TransferDirect distributes images by copying them from the build node to each node through the Docker API
+	TransferDirect = "direct"
+)
+
+// GetTransfer returns how the images of an application get to its nodes. The application's setting takes
+// precedence over the environment's, the default is the registry.
+func (app *Application) GetTransfer(env Environment) string {
+	if app.Transfer != "" {
+		return app.Transfer
+	}
+	if env.GetTransfer() != "" {
+		return env.GetTransfer()
+	}
+	return TransferRegistry
+}
+
+func validateTransfer(transfer string) error {
+	if transfer != "" && transfer != TransferRegistry && transfer != TransferDirect {
+		return fmt.Errorf("invalid transfer %s: must be %s or %s", transfer, TransferRegistry, TransferDirect)
+	}
+	return nil
+}
+
+// getImageRepository returns the repository the images of an application are tagged with
+func (app *Application) getImageRepository(env Environment) string {
+	if env.GetRegistry().Host == "" {
+		return app.Name
+	}
+	return env.GetRegistry().Host + "/" + app.Name
+}
+
+// transferImage makes an image available on a node, either by pulling it from the registry or, with the direct
+// transfer, by copying it from where the application is built unless the node has it already
+func (app *Application) transferImage(ctx context.Context, cli *client.Client, node Node, env Environment, imageName string, out io.Writer) error {
+	if app.GetTransfer(env) != TransferDirect {
+		return pullImage(ctx, cli, imageName, "", out)
+	}
+
+	if _, _, err := cli.ImageInspectWithRaw(ctx, imageName); err == nil {
+		return nil
+	} else if !client.IsErrNotFound(err) {
+		return err
+	}
+
+	sourceClient, source, err := app.getBuildClient(env)
+	if err != nil {
+		return err
+	}
+	if _, _, err := sourceClient.ImageInspectWithRaw(ctx, imageName); client.IsErrNotFound(err) {
+		// preconfigured images were never built, so the build node might not have them either
+		err = pullImage(ctx, sourceClient, imageName, app.BuildCfg.Platform, out)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	newLogger(out).Printf("Copying %s from %s to %s\n", imageName, source, node.Name)
+	image, err := sourceClient.ImageSave(ctx, []string{imageName})
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	loadResponse, err := cli.ImageLoad(ctx, image, true)
+	if err != nil {
+		return err
+	}
+	defer loadResponse.Body.Close()
+	return scanAndPrint(out, loadResponse.Body)
+}
+
+func pullImage(ctx context.Context, cli *client.Client, imageName string, platform string, out io.Writer) error {
+	pullResponse, err := cli.ImagePull(ctx, imageName, types.ImagePullOptions{Platform: platform})
+	if err != nil {
+		return err
+	}
+	defer pullResponse.Close()
+	return scanAndPrint(out, pullResponse)
+}
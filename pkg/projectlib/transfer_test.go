@@ -0,0 +1,178 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/client"
+)
+
+// fakeDaemon is a stand-in for the parts of the Docker API used to transfer images. Saved images are just their
+// name and content separated by a newline.
+type fakeDaemon struct {
+	mu     sync.Mutex
+	images map[string]string
+	saves  int
+	loads  int
+	pulls  int
+}
+
+func newFakeDaemon(images map[string]string) (*fakeDaemon, *httptest.Server) {
+	daemon := &fakeDaemon{images: images}
+	return daemon, httptest.NewServer(daemon)
+}
+
+func (d *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:]
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/images/") && strings.HasSuffix(path, "/json"):
+		name := strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/json")
+		if _, ok := d.images[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"message": "No such image: %s"}`, name)
+			return
+		}
+		fmt.Fprintf(w, `{"Id": "sha256:%x", "RepoTags": ["%s"]}`, name, name)
+	case r.Method == http.MethodGet && path == "/images/get":
+		d.saves++
+		name := r.URL.Query().Get("names")
+		fmt.Fprintf(w, "%s\n%s", name, d.images[name])
+	case r.Method == http.MethodPost && path == "/images/load":
+		d.loads++
+		data, _ := ioutil.ReadAll(r.Body)
+		segments := strings.SplitN(string(data), "\n", 2)
+		d.images[segments[0]] = segments[1]
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"stream": "Loaded image: %s\n"}`, segments[0])
+	case r.Method == http.MethodPost && path == "/images/create":
+		d.pulls++
+		name := r.URL.Query().Get("fromImage") + ":" + r.URL.Query().Get("tag")
+		d.images[name] = "pulled"
+		fmt.Fprintf(w, `{"status": "Downloaded newer image for %s"}`, name)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+		fmt.Fprintf(w, `{"message": "%s %s is not supported"}`, r.Method, path)
+	}
+}
+
+func (d *fakeDaemon) getImage(name string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	data, ok := d.images[name]
+	return data, ok
+}
+
+// counts returns how often images were saved, loaded and pulled
+func (d *fakeDaemon) counts() (saves int, loads int, pulls int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.saves, d.loads, d.pulls
+}
+
+// transferWithFakes copies an image between two fake daemons. The source is the local daemon the application is
+// built with, which is found through DOCKER_HOST.
+func transferWithFakes(t *testing.T, source *httptest.Server, target *httptest.Server, imageName string) {
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+	os.Setenv("DOCKER_HOST", strings.Replace(source.URL, "http://", "tcp://", 1))
+
+	cli, err := client.NewClientWithOpts(client.WithVersion("1.37"), client.WithHost(strings.Replace(target.URL, "http://", "tcp://", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := Application{
+		Name:     "app",
+		Transfer: TransferDirect,
+		BuildCfg: AppBuild{NodeSelector: BuildLocal},
+	}
+	var out bytes.Buffer
+	err = app.transferImage(context.Background(), cli, Node{Name: "target"}, &environment{}, imageName, &out)
+	if err != nil {
+		t.Fatalf("transfer failed: %s\n%s", err, out.String())
+	}
+}
+
+func TestTransferImageCopiesMissingImage(t *testing.T) {
+	sourceDaemon, source := newFakeDaemon(map[string]string{"app:v1": "layers of v1"})
+	defer source.Close()
+	targetDaemon, target := newFakeDaemon(map[string]string{})
+	defer target.Close()
+
+	transferWithFakes(t, source, target, "app:v1")
+
+	if data, ok := targetDaemon.getImage("app:v1"); !ok || data != "layers of v1" {
+		t.Errorf("target has image %q (present: %v), expected the one of the source", data, ok)
+	}
+	saves, _, sourcePulls := sourceDaemon.counts()
+	_, loads, targetPulls := targetDaemon.counts()
+	if saves != 1 || loads != 1 {
+		t.Errorf("expected one save and one load, got %d saves and %d loads", saves, loads)
+	}
+	if sourcePulls != 0 || targetPulls != 0 {
+		t.Errorf("nothing should have been pulled")
+	}
+}
+
+func TestTransferImageSkipsPresentImage(t *testing.T) {
+	sourceDaemon, source := newFakeDaemon(map[string]string{"app:v1": "layers of v1"})
+	defer source.Close()
+	targetDaemon, target := newFakeDaemon(map[string]string{"app:v1": "layers of v1"})
+	defer target.Close()
+
+	transferWithFakes(t, source, target, "app:v1")
+
+	saves, _, _ := sourceDaemon.counts()
+	_, loads, _ := targetDaemon.counts()
+	if saves != 0 || loads != 0 {
+		t.Errorf("image should not have been copied again, got %d saves and %d loads", saves, loads)
+	}
+}
+
+func TestTransferImagePullsOnSourceFirst(t *testing.T) {
+	sourceDaemon, source := newFakeDaemon(map[string]string{})
+	defer source.Close()
+	targetDaemon, target := newFakeDaemon(map[string]string{})
+	defer target.Close()
+
+	transferWithFakes(t, source, target, "alpine:3.7")
+
+	_, _, sourcePulls := sourceDaemon.counts()
+	_, _, targetPulls := targetDaemon.counts()
+	if sourcePulls != 1 || targetPulls != 0 {
+		t.Errorf("expected the source to pull the image, got %d pulls on the source and %d on the target", sourcePulls, targetPulls)
+	}
+	if data, ok := targetDaemon.getImage("alpine:3.7"); !ok || data != "pulled" {
+		t.Errorf("target has image %q (present: %v), expected the one pulled by the source", data, ok)
+	}
+}
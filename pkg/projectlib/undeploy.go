@@ -0,0 +1,69 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Undeploy stops and removes the containers of an application from a node, or those of all applications of the
+// project if app is empty. It returns the names of the removed containers.
+func (node *Node) Undeploy(env Environment, app string) ([]string, error) {
+	ctx, cancel := node.getContext()
+	defer cancel()
+	client, err := node.GetDockerClient(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := node.findContainers(ctx, client, env, app, true)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0)
+	for _, c := range containers {
+		err := client.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{Force: true})
+		if err != nil {
+			return result, err
+		}
+		result = append(result, strings.TrimPrefix(c.Names[0], "/"))
+	}
+
+	if _, err := node.removeUnusedNetworks(ctx, client, env, false); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// RemoveDeployment forgets about an application on a node after it was undeployed
+func (lock *RiotLock) RemoveDeployment(app string, node string) {
+	delete(lock.Deployment[app], node)
+	if len(lock.Deployment[app]) == 0 {
+		delete(lock.Deployment, app)
+	}
+	delete(lock.Outcomes[app], node)
+	if len(lock.Outcomes[app]) == 0 {
+		delete(lock.Outcomes, app)
+	}
+}
@@ -22,7 +22,9 @@ package projectlib
 
 import (
 	"fmt"
-	"strconv"
+	"strings"
+
+	units "github.com/docker/go-units"
 )
 
 // Issue reports a single problem found in a project configuration
@@ -42,6 +44,10 @@ func (issue Issue) String() string {
 func (env *environment) Validate() ([]Issue, error) {
 	result := make([]Issue, 0)
 
+	if env.Name == "" {
+		result = append(result, Issue{Description: "Environment has no name. Riot uses it to recognise the containers of this project, so deploying requires one"})
+	}
+
 	issue, err := env.validateRegistry()
 	if err != nil {
 		return nil, err
@@ -60,13 +66,40 @@ func (env *environment) Validate() ([]Issue, error) {
 	}
 	result = append(result, issues...)
 
+	issues, err = env.validateNodeCapacity()
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, issues...)
+
+	issues, err = env.validateApplications()
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, issues...)
+
 	return result, nil
 }
 
 func (env *environment) validateRegistry() ([]Issue, error) {
 	result := make([]Issue, 0)
-	if env.GetRegistry().Host == "" {
-		result = append(result, Issue{Description: "Docker registry host must not be an empty string", IsFatal: true})
+	if err := validateTransfer(env.Transfer); err != nil {
+		result = append(result, Issue{Description: fmt.Sprintf("Environment has an %s", err), IsFatal: true})
+	}
+	if env.GetRegistry().Host != "" {
+		return result, nil
+	}
+
+	// the registry is only needed if some application transfers its images through it
+	apps, err := env.GetApplications()
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range apps {
+		if app.GetTransfer(env) == TransferRegistry {
+			result = append(result, Issue{Description: "Docker registry host must not be an empty string", IsFatal: true})
+			break
+		}
 	}
 	return result, nil
 }
@@ -85,7 +118,8 @@ func (env *environment) validateNodeNames() ([]Issue, error) {
 	return result, nil
 }
 
-func (env *environment) validateNodePorts() ([]Issue, error) {
+// getNodeApplications maps each node name to the applications deployed to it
+func (env *environment) getNodeApplications() (map[string][]Application, error) {
 	nodeAppMap := make(map[string][]Application)
 	apps, err := env.GetApplications()
 	if err != nil {
@@ -101,34 +135,277 @@ func (env *environment) validateNodePorts() ([]Issue, error) {
 			nodeAppMap[node.Name] = append(nodeAppMap[node.Name], app)
 		}
 	}
+	return nodeAppMap, nil
+}
+
+func (env *environment) validateNodePorts() ([]Issue, error) {
+	nodeAppMap, err := env.getNodeApplications()
+	if err != nil {
+		return nil, err
+	}
+
+	type portUse struct {
+		hostIP string
+		app    string
+	}
+
+	nodes := make(map[string]Node)
+	for _, node := range env.Nodes {
+		nodes[node.Name] = node
+	}
 
 	result := make([]Issue, 0)
+	reported := make(map[string]bool)
 	for nodeName, apps := range nodeAppMap {
-		portsUsed := make(map[string]string)
+		portsUsed := make(map[string][]portUse)
 		for _, app := range apps {
-			for sourcePort, targetPort := range app.RunCfg.Ports {
-				if nr, err := strconv.Atoi(sourcePort); err != nil || nr < 0 || nr > 65535 {
-					result = append(result, Issue{
-						Description: fmt.Sprintf("Source port %s on application %s is not a valid port number", targetPort, app.Name),
-						IsFatal:     true,
-					})
-				}
-				if nr, err := strconv.Atoi(targetPort); err != nil || nr < 0 || nr > 65535 {
-					result = append(result, Issue{
-						Description: fmt.Sprintf("Target port %s on application %s is not a valid port number", targetPort, app.Name),
-						IsFatal:     true,
-					})
+			rendered, err := app.Render(nodes[nodeName])
+			if err != nil {
+				// reported by validateAppEnvironment
+				continue
+			}
+
+			for hostPort, containerPort := range rendered.RunCfg.Ports {
+				mappings, err := parsePortMapping(hostPort, containerPort)
+				if err != nil {
+					description := fmt.Sprintf("Application %s has an %s", app.Name, err)
+					if !reported[description] {
+						result = append(result, Issue{Description: description, IsFatal: true})
+						reported[description] = true
+					}
+					continue
 				}
 
-				if _, ok := portsUsed[targetPort]; ok {
-					result = append(result, Issue{
-						Description: fmt.Sprintf("Port %s on node %s is used by applications %s and %s", targetPort, nodeName, portsUsed[targetPort], app.Name),
-						IsFatal:     true,
-					})
+				for _, mapping := range mappings {
+					if mapping.Binding.HostPort == "" {
+						// docker chooses a free host port
+						continue
+					}
+
+					key := mapping.Binding.HostPort + "/" + mapping.Port.Proto()
+					for _, use := range portsUsed[key] {
+						if use.hostIP == "" || mapping.Binding.HostIP == "" || use.hostIP == mapping.Binding.HostIP {
+							result = append(result, Issue{
+								Description: fmt.Sprintf("Port %s on node %s is used by applications %s and %s", key, nodeName, use.app, app.Name),
+								IsFatal:     true,
+							})
+						}
+					}
+					portsUsed[key] = append(portsUsed[key], portUse{hostIP: mapping.Binding.HostIP, app: app.Name})
 				}
-				portsUsed[targetPort] = app.Name
 			}
 		}
 	}
 	return result, nil
 }
+
+func (env *environment) validateNodeCapacity() ([]Issue, error) {
+	nodeAppMap, err := env.getNodeApplications()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Issue, 0)
+	for _, node := range env.Nodes {
+		capacity, err := parseMemory(node.Capacity.Memory)
+		if err != nil {
+			result = append(result, Issue{
+				Description: fmt.Sprintf("Node %s has an invalid memory capacity %s: %s", node.Name, node.Capacity.Memory, err),
+				IsFatal:     true,
+			})
+			continue
+		} else if capacity <= 0 {
+			continue
+		}
+
+		var total int64
+		for _, app := range nodeAppMap[node.Name] {
+			if memory, err := parseMemory(app.RunCfg.Limits.Memory); err == nil && memory > 0 {
+				total += memory
+			}
+		}
+		if total > capacity {
+			result = append(result, Issue{
+				Description: fmt.Sprintf("Applications on node %s declare %s of memory, but the node only has %s", node.Name, units.BytesSize(float64(total)), units.BytesSize(float64(capacity))),
+			})
+		}
+	}
+	return result, nil
+}
+
+func (env *environment) validateApplications() ([]Issue, error) {
+	apps, err := env.GetApplications()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Issue, 0)
+	for _, app := range apps {
+		if _, err := parseRestartPolicy(app.RunCfg.Restart); err != nil {
+			result = append(result, Issue{
+				Description: fmt.Sprintf("Application %s has an %s", app.Name, err),
+				IsFatal:     true,
+			})
+		}
+
+		if err := validateTransfer(app.Transfer); err != nil {
+			result = append(result, Issue{
+				Description: fmt.Sprintf("Application %s has an %s", app.Name, err),
+				IsFatal:     true,
+			})
+		}
+
+		if _, err := app.RunCfg.Limits.getResources(); err != nil {
+			result = append(result, Issue{
+				Description: fmt.Sprintf("Application %s has invalid limits: %s", app.Name, err),
+				IsFatal:     true,
+			})
+		}
+		if _, err := app.RunCfg.getNetworkMode(); err != nil {
+			result = append(result, Issue{
+				Description: fmt.Sprintf("Application %s has an %s", app.Name, err),
+				IsFatal:     true,
+			})
+		} else if strings.HasPrefix(app.RunCfg.NetworkMode, "container:") {
+			other := strings.TrimPrefix(app.RunCfg.NetworkMode, "container:")
+			if _, err := env.GetApplication(other); err != nil {
+				result = append(result, Issue{
+					Description: fmt.Sprintf("Application %s shares the network of unknown application %s", app.Name, other),
+					IsFatal:     true,
+				})
+			}
+		}
+		if _, err := app.RunCfg.Healthcheck.getHealthConfig(); err != nil {
+			result = append(result, Issue{
+				Description: fmt.Sprintf("Application %s has an invalid healthcheck: %s", app.Name, err),
+				IsFatal:     true,
+			})
+		}
+		if check := app.RunCfg.Healthcheck; check.Wait && app.RunCfg.StartTimeout > 0 && app.RunCfg.StartTimeout <= check.getInterval() {
+			result = append(result, Issue{
+				Description: fmt.Sprintf("Application %s waits for its healthcheck, but its startTimeout of %s ends before the first probe after %s. Deployments will be rolled back", app.Name, app.RunCfg.StartTimeout, check.getInterval()),
+				IsFatal:     true,
+			})
+		}
+		if err := app.RolloutCfg.validate(); err != nil {
+			result = append(result, Issue{
+				Description: fmt.Sprintf("Application %s has an invalid rollout: %s", app.Name, err),
+				IsFatal:     true,
+			})
+		}
+		issues, err := env.validateAppVolumes(app)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, issues...)
+		if _, err := app.RunCfg.getDevices(); err != nil {
+			result = append(result, Issue{
+				Description: fmt.Sprintf("Application %s has an %s", app.Name, err),
+				IsFatal:     true,
+			})
+		}
+		if app.RunCfg.Priviliged {
+			hasGrants := len(app.RunCfg.Devices) > 0 || len(app.RunCfg.CapAdd) > 0 || len(app.RunCfg.DeviceCgroupRules) > 0
+			if hasGrants {
+				result = append(result, Issue{
+					Description: fmt.Sprintf("Application %s runs privileged, which makes its devices, capAdd and deviceCgroupRules redundant. Consider dropping priviliged", app.Name),
+				})
+			} else {
+				result = append(result, Issue{
+					Description: fmt.Sprintf("Application %s runs privileged. Consider granting only what it needs using devices, capAdd or deviceCgroupRules", app.Name),
+				})
+			}
+		}
+
+		issues, err = env.validateAppEnvironment(app)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, issues...)
+	}
+	return result, nil
+}
+
+func (env *environment) validateAppEnvironment(app Application) ([]Issue, error) {
+	result := make([]Issue, 0)
+	for nodeName := range app.RunCfg.NodeEnv {
+		nodes, err := env.SelectNodes("#" + nodeName)
+		if err != nil {
+			return nil, err
+		}
+		if len(nodes) == 0 {
+			result = append(result, Issue{
+				Description: fmt.Sprintf("Application %s sets environment variables for unknown node %s", app.Name, nodeName),
+			})
+		}
+	}
+
+	nodes, err := app.SelectDeploymentTargets(env)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		rendered, err := app.Render(node)
+		if err != nil {
+			result = append(result, Issue{
+				Description: err.Error(),
+				IsFatal:     true,
+			})
+			continue
+		}
+
+		vars, err := rendered.getEnvVars(node, env)
+		if err != nil {
+			result = append(result, Issue{
+				Description: fmt.Sprintf("Cannot load the environment of application %s: %s", app.Name, err),
+				IsFatal:     true,
+			})
+			return result, nil
+		}
+
+		for name, value := range vars {
+			for _, ref := range findUndefinedVariables(value, vars) {
+				result = append(result, Issue{
+					Description: fmt.Sprintf("Variable %s of application %s on node %s references undefined variable %s", name, app.Name, node.Name, ref),
+				})
+			}
+		}
+	}
+	return result, nil
+}
+
+func (env *environment) validateAppVolumes(app Application) ([]Issue, error) {
+	nodes, err := app.SelectDeploymentTargets(env)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Issue, 0)
+	reported := make(map[string]bool)
+	report := func(description string) {
+		if !reported[description] {
+			result = append(result, Issue{Description: description, IsFatal: true})
+			reported[description] = true
+		}
+	}
+	for _, node := range nodes {
+		rendered, err := app.Render(node)
+		if err != nil {
+			// reported by validateAppEnvironment
+			continue
+		}
+
+		targets := make(map[string]bool)
+		for _, volume := range rendered.RunCfg.Volumes {
+			if _, err := volume.getMount(); err != nil {
+				report(fmt.Sprintf("Application %s has an %s", app.Name, err))
+			}
+
+			if targets[volume.Target] {
+				report(fmt.Sprintf("Application %s mounts more than one volume at %s", app.Name, volume.Target))
+			}
+			targets[volume.Target] = true
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,212 @@
+// Copyright © 2018 Christian Weichel <christian@csweichel.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package projectlib
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+// AppVolume is a single mount of an application container
+type AppVolume struct {
+	Type        string `yaml:"type,omitempty"`
+	Source      string `yaml:"source,omitempty"`
+	Target      string `yaml:"target"`
+	ReadOnly    bool   `yaml:"readOnly,omitempty"`
+	Propagation string `yaml:"propagation,omitempty"`
+	Size        string `yaml:"size,omitempty"`
+}
+
+// AppVolumes are all mounts of an application container
+type AppVolumes []AppVolume
+
+// UnmarshalYAML accepts either a map of source to target, or a list of volumes
+func (volumes *AppVolumes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var sourceToTarget map[string]string
+	if err := unmarshal(&sourceToTarget); err == nil {
+		result := make(AppVolumes, 0, len(sourceToTarget))
+		for source, target := range sourceToTarget {
+			volume, err := parseVolume(source + ":" + target)
+			if err != nil {
+				return err
+			}
+			result = append(result, volume)
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].Target < result[j].Target })
+
+		*volumes = result
+		return nil
+	}
+
+	var list []AppVolume
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*volumes = list
+	return nil
+}
+
+// UnmarshalYAML accepts either the short [source:]target[:options] form or a full volume description
+func (volume *AppVolume) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var spec string
+	if err := unmarshal(&spec); err == nil {
+		result, err := parseVolume(spec)
+		if err != nil {
+			return err
+		}
+
+		*volume = result
+		return nil
+	}
+
+	type plainVolume AppVolume
+	return unmarshal((*plainVolume)(volume))
+}
+
+// parseVolume parses the short volume form [source:]target[:options] where options is a comma separated list
+// of ro, rw, a bind propagation mode or size=<size> for tmpfs mounts. The source tmpfs denotes a tmpfs mount.
+func parseVolume(spec string) (AppVolume, error) {
+	parts := strings.Split(spec, ":")
+	var result AppVolume
+	switch len(parts) {
+	case 1:
+		result.Target = parts[0]
+	case 2, 3:
+		result.Source = parts[0]
+		result.Target = parts[1]
+	default:
+		return AppVolume{}, fmt.Errorf("invalid volume %s: must be [source:]target[:options]", spec)
+	}
+
+	if result.Source == "tmpfs" {
+		result.Type = string(mount.TypeTmpfs)
+		result.Source = ""
+	}
+
+	if len(parts) == 3 {
+		for _, option := range strings.Split(parts[2], ",") {
+			switch {
+			case option == "ro":
+				result.ReadOnly = true
+			case option == "rw":
+				result.ReadOnly = false
+			case strings.HasPrefix(option, "size="):
+				result.Size = strings.TrimPrefix(option, "size=")
+			case isPropagation(option):
+				result.Propagation = option
+			default:
+				return AppVolume{}, fmt.Errorf("invalid volume %s: unknown option %s", spec, option)
+			}
+		}
+	}
+	return result, nil
+}
+
+func isPropagation(value string) bool {
+	for _, propagation := range mount.Propagations {
+		if string(propagation) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getType returns the mount type of a volume. Unless set explicitly, sources which look like a path are bind mounts
+// and everything else is a named volume. Volumes without source are anonymous volumes.
+func (volume *AppVolume) getType() mount.Type {
+	if volume.Type != "" {
+		return mount.Type(volume.Type)
+	}
+
+	if strings.HasPrefix(volume.Source, "/") || strings.HasPrefix(volume.Source, ".") || strings.HasPrefix(volume.Source, "~") {
+		return mount.TypeBind
+	}
+	return mount.TypeVolume
+}
+
+// getMount converts a volume into a docker mount
+func (volume *AppVolume) getMount() (mount.Mount, error) {
+	description := volume.Source + ":" + volume.Target
+	if !filepath.IsAbs(volume.Target) {
+		return mount.Mount{}, fmt.Errorf("invalid volume %s: target must be an absolute path", description)
+	}
+
+	volumeType := volume.getType()
+	result := mount.Mount{
+		Type:     volumeType,
+		Source:   volume.Source,
+		Target:   volume.Target,
+		ReadOnly: volume.ReadOnly,
+	}
+	if volume.Propagation != "" && volumeType != mount.TypeBind {
+		return mount.Mount{}, fmt.Errorf("invalid volume %s: only bind mounts support propagation", description)
+	}
+	if volume.Size != "" && volumeType != mount.TypeTmpfs {
+		return mount.Mount{}, fmt.Errorf("invalid volume %s: only tmpfs mounts support a size", description)
+	}
+
+	switch volumeType {
+	case mount.TypeBind:
+		if !filepath.IsAbs(volume.Source) {
+			return mount.Mount{}, fmt.Errorf("invalid volume %s: host paths must be absolute", description)
+		}
+		if volume.Propagation != "" {
+			if !isPropagation(volume.Propagation) {
+				return mount.Mount{}, fmt.Errorf("invalid volume %s: unknown propagation %s", description, volume.Propagation)
+			}
+			result.BindOptions = &mount.BindOptions{Propagation: mount.Propagation(volume.Propagation)}
+		}
+	case mount.TypeVolume:
+		// named volumes are created by docker on demand, volumes without source are anonymous
+	case mount.TypeTmpfs:
+		if volume.Source != "" {
+			return mount.Mount{}, fmt.Errorf("invalid volume %s: tmpfs mounts have no source", description)
+		}
+		if volume.Size != "" {
+			size, err := parseMemory(volume.Size)
+			if err != nil || size <= 0 {
+				return mount.Mount{}, fmt.Errorf("invalid volume %s: invalid size %s", description, volume.Size)
+			}
+			result.TmpfsOptions = &mount.TmpfsOptions{SizeBytes: size}
+		}
+	default:
+		return mount.Mount{}, fmt.Errorf("invalid volume %s: unknown type %s. Must be bind, volume or tmpfs", description, volume.Type)
+	}
+
+	return result, nil
+}
+
+// getMounts converts all volumes of an application into docker mounts
+func (run *AppRun) getMounts() ([]mount.Mount, error) {
+	result := make([]mount.Mount, 0, len(run.Volumes))
+	for _, volume := range run.Volumes {
+		m, err := volume.getMount()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}